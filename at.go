@@ -0,0 +1,219 @@
+package gsm
+
+import (
+	"context"
+	"log"
+	"strconv"
+	"strings"
+)
+
+// Final result code of an AT command
+type ResultCode int
+
+const (
+	ResultOK    ResultCode = iota
+	ResultError            // plain ERROR
+	ResultCME              // +CME ERROR, equipment error
+	ResultCMS              // +CMS ERROR, message service error
+)
+
+func (r ResultCode) String() string {
+	switch r {
+	case ResultOK:
+		return "OK"
+	case ResultError:
+		return "ERROR"
+	case ResultCME:
+		return "+CME ERROR"
+	case ResultCMS:
+		return "+CMS ERROR"
+	}
+	return "unknown"
+}
+
+// Response to an AT command
+type Response struct {
+	Lines  []string // intermediate lines, without echo
+	Result ResultCode
+	Code   int    // error number of +CME ERROR and +CMS ERROR, -1 if not numeric or none
+	Text   string // error text of +CME ERROR and +CMS ERROR in verbose mode (AT+CMEE=2)
+}
+
+// Returns nil for OK, otherwise error with code matching the modem error
+func (r *Response) Err() error {
+	if r.Result == ResultOK {
+		return nil
+	}
+
+	code := CodeUnknown
+	switch r.Result {
+	case ResultCME:
+		code = cmeCodes[r.Code]
+	case ResultCMS:
+		code = cmsCodes[r.Code]
+	}
+
+	msg := r.Result.String()
+	switch {
+	case r.Code >= 0:
+		msg += ": " + strconv.Itoa(r.Code)
+	case r.Text != "":
+		msg += ": " + r.Text
+	}
+	return &Error{Code: code, Op: "at", Msg: msg}
+}
+
+// +CME ERROR numbers, see 3GPP TS 27.007 9.2
+var cmeCodes = map[int]ErrorCode{
+	3:   CodeNotSupported, // operation not allowed
+	4:   CodeNotSupported,
+	5:   CodeSecurity, // PH-SIM PIN required
+	10:  CodeNoSIM,
+	11:  CodeSecurity, // SIM PIN required
+	12:  CodeSecurity, // SIM PUK required
+	13:  CodeNoSIM,    // SIM failure
+	14:  CodeBusy,     // SIM busy
+	16:  CodeSecurity, // incorrect password
+	17:  CodeSecurity, // SIM PIN2 required
+	18:  CodeSecurity, // SIM PUK2 required
+	20:  CodeFull,
+	21:  CodeInvalidLocation,
+	22:  CodeEmpty, // not found
+	23:  CodeMemory,
+	30:  CodeNetwork, // no network service
+	31:  CodeTimeout, // network timeout
+	32:  CodeNetwork, // emergency calls only
+	100: CodeUnknown,
+}
+
+// +CMS ERROR numbers, see 3GPP TS 27.005 3.2.5
+var cmsCodes = map[int]ErrorCode{
+	301: CodeNotSupported, // SMS service reserved
+	302: CodeNotSupported, // operation not allowed
+	303: CodeNotSupported,
+	304: CodeInvalidData, // invalid PDU mode parameter
+	305: CodeInvalidData, // invalid text mode parameter
+	310: CodeNoSIM,
+	311: CodeSecurity, // SIM PIN required
+	312: CodeSecurity, // PH-SIM PIN required
+	313: CodeNoSIM,    // SIM failure
+	314: CodeBusy,     // SIM busy
+	316: CodeSecurity, // SIM PUK required
+	320: CodeMemory,   // memory failure
+	321: CodeInvalidLocation,
+	322: CodeFull,
+	330: CodeEmptySMSC, // SMSC address unknown
+	331: CodeNetwork,   // no network service
+	332: CodeTimeout,   // network timeout
+	500: CodeUnknown,
+}
+
+// Returns response for final result line, nil if line is not a final result
+func finalResponse(line string) *Response {
+	switch {
+	case line == "OK":
+		return &Response{Result: ResultOK, Code: -1}
+	case line == "ERROR":
+		return &Response{Result: ResultError, Code: -1}
+	case strings.HasPrefix(line, "+CME ERROR:"):
+		return errorResponse(ResultCME, line[len("+CME ERROR:"):])
+	case strings.HasPrefix(line, "+CMS ERROR:"):
+		return errorResponse(ResultCMS, line[len("+CMS ERROR:"):])
+	}
+	return nil
+}
+
+func errorResponse(result ResultCode, param string) *Response {
+	param = strings.TrimSpace(param)
+	if n, err := strconv.Atoi(param); err == nil {
+		return &Response{Result: result, Code: n}
+	}
+	return &Response{Result: result, Code: -1, Text: param}
+}
+
+// Sends AT command and returns its response.
+//
+// The carriage return is appended if missing. Err is set if the command does
+// not end with OK, the response is returned as well then.
+func (m *Modem) Exec(ctx context.Context, cmd string) (*Response, error) {
+	m.cmdLock.Lock()
+	defer m.cmdLock.Unlock()
+
+	if err := m.command(cmd); err != nil {
+		return nil, err
+	}
+	return m.response(ctx, cmd)
+}
+
+// Sends AT command, waits for the "> " prompt and sends text ended by Ctrl-Z.
+//
+// Used for AT+CMGS and AT+CMGW, text is the PDU in hex or message text.
+func (m *Modem) ExecPrompt(ctx context.Context, cmd, text string) (*Response, error) {
+	m.cmdLock.Lock()
+	defer m.cmdLock.Unlock()
+
+	if err := m.command(cmd); err != nil {
+		return nil, err
+	}
+
+	for {
+		line, err := m.readLineContext(ctx)
+		if err != nil {
+			m.write("\x1b") // cancels the prompt
+			return nil, err
+		}
+		if line == prompt {
+			break
+		}
+		if r := finalResponse(line); r != nil {
+			return r, r.Err()
+		}
+	}
+
+	log.Println("--- Send:", m.transposeLog(text), "^Z")
+	if err := m.write(text + "\x1a"); err != nil {
+		return nil, err
+	}
+	return m.response(ctx, cmd)
+}
+
+// Writes command to the port
+func (m *Modem) command(cmd string) error {
+	if !strings.HasSuffix(cmd, "\r") {
+		cmd += "\r"
+	}
+	log.Println("--- Send:", m.transposeLog(cmd))
+	m.drain()
+	m.setPending(cmd)
+	return m.write(cmd)
+}
+
+func (m *Modem) write(s string) error {
+	m.record(sent, []byte(s))
+	_, err := m.Port.Write([]byte(s))
+	if err != nil {
+		return &Error{Code: CodeDeviceIO, Op: "write", Msg: err.Error()}
+	}
+	return nil
+}
+
+// Reads response lines until final result
+func (m *Modem) response(ctx context.Context, cmd string) (*Response, error) {
+	echo := strings.TrimSpace(cmd)
+	var lines []string
+	for {
+		line, err := m.readLineContext(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if line == echo || line == prompt {
+			continue
+		}
+		if r := finalResponse(line); r != nil {
+			r.Lines = lines
+			log.Println("--- Result:", r.Result, "Lines:", len(lines))
+			return r, r.Err()
+		}
+		lines = append(lines, line)
+	}
+}
@@ -0,0 +1,358 @@
+package gsm
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/gemaalief/gsmgo/pdu"
+)
+
+var _ Backend = (*ATBackend)(nil)
+
+// Backend talking AT commands to a modem, messages are in PDU mode
+type ATBackend struct {
+	modem *Modem
+
+	lock    sync.Mutex
+	handler func(*Message) error
+	remove  func()
+}
+
+// Returns backend on modem
+func NewATBackend(m *Modem) *ATBackend {
+	return &ATBackend{modem: m}
+}
+
+// Returns modem of the backend, for commands the backend does not cover
+func (b *ATBackend) Modem() *Modem {
+	return b.modem
+}
+
+func (b *ATBackend) SendContext(ctx context.Context, text, number string, opts ...SendOptions) (*SendResult, error) {
+	return b.modem.SendSMSContext(ctx, text, number, opts...)
+}
+
+// Reads all stored messages (AT+CMGL=4)
+func (b *ATBackend) ReadSMSContext(ctx context.Context, delete bool) ([]*Message, error) {
+	if _, err := b.modem.Exec(ctx, "AT+CMGF=0"); err != nil {
+		return nil, err
+	}
+	resp, err := b.modem.Exec(ctx, "AT+CMGL=4")
+	if err != nil {
+		return nil, err
+	}
+
+	messages := pduListing(resp.Lines, -1)
+	if delete {
+		for _, msg := range messages {
+			if err := b.DeleteSMSContext(ctx, msg); err != nil {
+				return messages, err
+			}
+		}
+	}
+	return messages, nil
+}
+
+// Deletes message by its location (AT+CMGD)
+func (b *ATBackend) DeleteSMSContext(ctx context.Context, msg *Message) error {
+	_, err := b.modem.Exec(ctx, fmt.Sprintf("AT+CMGD=%d", msg.Location))
+	return err
+}
+
+func (b *ATBackend) USSDContext(ctx context.Context, code string) (*USSDResponse, error) {
+	return NewUSSDSession(b.modem).StartContext(ctx, code)
+}
+
+// Sets handler called with incoming messages, new messages are announced with +CMTI
+// and read from the phone (AT+CNMI=2,1)
+func (b *ATBackend) SetMessageHandler(fx func(*Message) error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	if b.remove != nil {
+		b.remove()
+		b.remove = nil
+	}
+	b.handler = fx
+	if fx == nil {
+		return
+	}
+
+	b.remove = b.modem.Handle("+CMTI", b.incoming)
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeOut)
+	defer cancel()
+	if _, err := b.modem.Exec(ctx, "AT+CNMI=2,1,0,0,0"); err != nil {
+		log.Printf("error : %s", err.Error())
+	}
+}
+
+// Reads message announced by +CMTI: <mem>,<index> and passes it to the handler
+func (b *ATBackend) incoming(u *URC) {
+	b.lock.Lock()
+	handler := b.handler
+	b.lock.Unlock()
+	if handler == nil {
+		return
+	}
+
+	index, err := strconv.Atoi(strings.TrimSpace(u.Params[strings.LastIndex(u.Params, ",")+1:]))
+	if err != nil {
+		log.Printf("error : invalid %s", u.Line)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), sendTimeout)
+	defer cancel()
+
+	if _, err := b.modem.Exec(ctx, "AT+CMGF=0"); err != nil {
+		log.Printf("error : %s", err.Error())
+		return
+	}
+	resp, err := b.modem.Exec(ctx, fmt.Sprintf("AT+CMGR=%d", index))
+	if err != nil {
+		log.Printf("error : %s", err.Error())
+		return
+	}
+
+	for _, msg := range pduListing(resp.Lines, index) {
+		if err := handler(msg); err != nil {
+			log.Printf("error : %s", err.Error())
+		}
+	}
+}
+
+// Returns identification (AT+CGMI, AT+CGMM, AT+CGMR, AT+CGSN, AT+CIMI) and SIM ICCID
+// (AT+CCID, AT^ICCID? on Huawei modems), fields the modem rejects are left empty
+func (b *ATBackend) Info() (*DeviceInfo, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), sendTimeout)
+	defer cancel()
+
+	info := &DeviceInfo{}
+	fields := []struct {
+		command, prefix string
+		value           *string
+	}{
+		{"AT+CGMI", "+CGMI", &info.Manufacturer},
+		{"AT+CGMM", "+CGMM", &info.Model},
+		{"AT+CGMR", "+CGMR", &info.Firmware},
+		{"AT+CGSN", "+CGSN", &info.IMEI},
+		{"AT+CIMI", "+CIMI", &info.IMSI},
+		{"AT+CCID", "+CCID", &info.ICCID},
+		{"AT^ICCID?", "^ICCID", &info.ICCID},
+	}
+
+	for _, f := range fields {
+		if *f.value != "" {
+			continue
+		}
+		resp, err := b.modem.Exec(ctx, f.command)
+		if resp == nil {
+			return nil, err
+		}
+		if err == nil {
+			*f.value = infoValue(resp.Lines, f.prefix)
+		}
+	}
+	return info, nil
+}
+
+// Returns signal (AT+CSQ), registration (AT+CREG?), operator (AT+COPS?) and battery (AT+CBC) status
+func (b *ATBackend) Status() (*DeviceStatus, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), sendTimeout)
+	defer cancel()
+
+	status := &DeviceStatus{SignalPercent: -1, BitErrorRate: -1, BatteryPercent: -1}
+
+	resp, err := b.modem.Exec(ctx, "AT+CSQ")
+	if err != nil {
+		return nil, err
+	}
+	if p := responseParams(resp.Lines, "+CSQ"); len(p) >= 2 {
+		rssi, _ := strconv.Atoi(p[0])
+		ber, _ := strconv.Atoi(p[1])
+		if rssi >= 0 && rssi <= 31 {
+			status.SignalStrength = -113 + 2*rssi
+			status.SignalPercent = rssi * 100 / 31
+		}
+		if ber >= 0 && ber < len(bitErrorRates) {
+			status.BitErrorRate = bitErrorRates[ber]
+		}
+	}
+
+	resp, err = b.modem.Exec(ctx, "AT+CREG?")
+	if err != nil {
+		return nil, err
+	}
+	if p := responseParams(resp.Lines, "+CREG"); len(p) >= 2 {
+		stat, _ := strconv.Atoi(p[1])
+		status.Network = registrationState(stat)
+		if len(p) >= 4 {
+			status.LAC, status.CellID = strings.Trim(p[2], "\""), strings.Trim(p[3], "\"")
+		}
+	}
+
+	resp, err = b.modem.Exec(ctx, "AT+COPS?")
+	if err != nil {
+		return nil, err
+	}
+	if p := responseParams(resp.Lines, "+COPS"); len(p) >= 3 {
+		operator := strings.Trim(p[2], "\"")
+		if p[1] == "2" {
+			status.OperatorCode = operator
+		} else {
+			status.OperatorName = operator
+		}
+	}
+
+	// battery is not reported by most modems
+	resp, err = b.modem.Exec(ctx, "AT+CBC")
+	if err == nil {
+		if p := responseParams(resp.Lines, "+CBC"); len(p) >= 2 {
+			status.Charging = p[0] == "1"
+			status.BatteryPercent, _ = strconv.Atoi(p[1])
+		}
+	}
+
+	return status, nil
+}
+
+// Closes the modem
+func (b *ATBackend) Terminate() error {
+	return b.modem.Close()
+}
+
+// Bit error rate in percent for +CSQ <ber>, middle of the range of 3GPP TS 45.008 8.2.4
+var bitErrorRates = []int{0, 0, 1, 1, 2, 5, 10, 13}
+
+// Returns network state for +CREG <stat>
+func registrationState(stat int) NetworkState {
+	switch stat {
+	case 0:
+		return NetworkNone
+	case 1:
+		return NetworkHome
+	case 2:
+		return NetworkSearching
+	case 3:
+		return NetworkDenied
+	case 5:
+		return NetworkRoaming
+	}
+	return NetworkUnknown
+}
+
+// Returns comma separated parameters of the first response line with prefix
+func responseParams(lines []string, prefix string) []string {
+	for _, line := range lines {
+		if strings.HasPrefix(line, prefix+":") {
+			p := strings.Split(strings.TrimSpace(line[len(prefix)+1:]), ",")
+			for i := range p {
+				p[i] = strings.TrimSpace(p[i])
+			}
+			return p
+		}
+	}
+	return nil
+}
+
+// Returns messages of +CMGL: <index>,<stat>,... or +CMGR: <stat>,... response,
+// each header line is followed by the PDU. Index is used for +CMGR.
+func pduListing(lines []string, index int) []*Message {
+	var messages []*Message
+	for i := 0; i+1 < len(lines); i++ {
+		var p []string
+		switch {
+		case strings.HasPrefix(lines[i], "+CMGL:"):
+			p = responseParams(lines[i:i+1], "+CMGL")
+			if len(p) < 2 {
+				continue
+			}
+			index, _ = strconv.Atoi(p[0])
+			p = p[1:]
+		case strings.HasPrefix(lines[i], "+CMGR:"):
+			p = responseParams(lines[i:i+1], "+CMGR")
+		default:
+			continue
+		}
+
+		i++
+		decoded, err := pdu.DecodeHex(lines[i])
+		if err != nil {
+			log.Printf("error : message %d: %s", index, err.Error())
+			continue
+		}
+		stat, _ := strconv.Atoi(p[0])
+		messages = append(messages, pduMessage(index, stat, decoded))
+	}
+	return messages
+}
+
+// Message state for +CMGL <stat> in PDU mode
+var listStates = map[int]State{
+	0: StateUnread,
+	1: StateRead,
+	2: StateUnsent,
+	3: StateSent,
+}
+
+// Converts decoded PDU stored at index
+func pduMessage(index, stat int, decoded interface{}) *Message {
+	msg := &Message{
+		Location: index,
+		State:    listStates[stat],
+		Class:    -1,
+		SrcPort:  -1,
+		DstPort:  -1,
+	}
+	msg.UDH.ID = -1
+
+	var udh pdu.UDH
+	alphabet := pdu.AlphabetDefault
+
+	switch p := decoded.(type) {
+	case *pdu.Deliver:
+		msg.PDU = PDUDeliver
+		msg.Number, msg.SMSC = p.Number, p.SMSC
+		msg.SMSCTime, msg.DateTime = p.Timestamp, p.Timestamp
+		msg.Text, msg.Data, msg.Class = p.Text, p.Data, p.Class
+		udh, alphabet = p.UDH, p.Alphabet
+	case *pdu.Submit:
+		msg.PDU = PDUSubmit
+		msg.Number, msg.SMSC = p.Number, p.SMSC
+		msg.Text, msg.Data, msg.Class = p.Text, p.Data, p.Class
+		msg.MessageReference = int(p.MessageReference)
+		udh, alphabet = p.UDH, p.Alphabet
+	case *pdu.StatusReport:
+		msg.PDU = PDUStatusReport
+		msg.Number, msg.SMSC = p.Number, p.SMSC
+		msg.SMSCTime, msg.DateTime = p.Timestamp, p.Discharge
+		msg.MessageReference = int(p.MessageReference)
+		msg.DeliveryStatus = int(p.Status)
+	}
+
+	switch alphabet {
+	case pdu.AlphabetUCS2:
+		msg.Coding = CodingUnicode
+	case pdu.Alphabet8bit:
+		msg.Coding = Coding8bit
+	default:
+		msg.Coding = CodingDefault
+	}
+
+	if len(udh) > 0 {
+		msg.UDH.Data = udh.Bytes()
+		if ref, parts, part, ok := udh.Concat(); ok {
+			msg.UDH.ID, msg.UDH.Parts, msg.UDH.Part = ref, parts, part
+		}
+		if src, dst, ok := udh.Ports(); ok {
+			msg.SrcPort, msg.DstPort = src, dst
+		}
+	}
+
+	return msg
+}
@@ -0,0 +1,33 @@
+package gsm
+
+import (
+	"context"
+)
+
+// Phone or modem sending and receiving messages.
+//
+// Implemented by GSM with libGammu, ATBackend with plain AT commands and
+// gsmtest.Fake in memory.
+type Backend interface {
+	// Sends text as a single or multipart message, using UCS-2 if needed
+	SendContext(ctx context.Context, text, number string, opts ...SendOptions) (*SendResult, error)
+
+	// Reads messages stored in the phone, deleting them if delete is set
+	ReadSMSContext(ctx context.Context, delete bool) ([]*Message, error)
+
+	// Deletes message returned by ReadSMSContext
+	DeleteSMSContext(ctx context.Context, msg *Message) error
+
+	// Sends USSD code and returns the network reply
+	USSDContext(ctx context.Context, code string) (*USSDResponse, error)
+
+	// Sets handler called with incoming messages, nil removes it.
+	// GSM calls it only while WaitForSMS is enabled.
+	SetMessageHandler(fx func(*Message) error)
+
+	// Returns signal, battery and network status
+	Status() (*DeviceStatus, error)
+
+	// Closes the connection, the backend can not be used afterwards
+	Terminate() error
+}
@@ -0,0 +1,52 @@
+package gsm
+
+import (
+	"unicode/utf16"
+
+	"github.com/gemaalief/gsmgo/gsm7"
+)
+
+// Message size limits, in septets for the default alphabet and UTF-16 units for UCS-2
+const (
+	gsm7Single = 160
+	gsm7Part   = 153 // 7 septets taken by concatenation UDH
+	ucs2Single = 70
+	ucs2Part   = 67
+)
+
+// Returns true if all runes of text are in the default alphabet or its extension table
+func isGSM7(text string) bool {
+	return gsm7.Valid(text)
+}
+
+// Returns number of message parts needed for text and whether it is sent as
+// UCS-2, either forced by unicode or because text does not fit the default alphabet
+func countParts(text string, unicode bool) (parts int, ucs2 bool) {
+	ucs2 = unicode || !isGSM7(text)
+
+	single, part := gsm7Single, gsm7Part
+	if ucs2 {
+		single, part = ucs2Single, ucs2Part
+	}
+
+	// characters are never split across parts
+	total, used := 0, 0
+	parts = 1
+	for _, r := range text {
+		n := gsm7.Tables{}.Septets(r)
+		if ucs2 {
+			n = len(utf16.Encode([]rune{r}))
+		}
+		total += n
+		if used+n > part {
+			parts++
+			used = 0
+		}
+		used += n
+	}
+
+	if total <= single {
+		return 1, ucs2
+	}
+	return parts, ucs2
+}
@@ -0,0 +1,43 @@
+package gsm
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCountParts(t *testing.T) {
+	tests := []struct {
+		name    string
+		text    string
+		unicode bool
+		parts   int
+		ucs2    bool
+	}{
+		{"empty", "", false, 1, false},
+		{"160 septets", strings.Repeat("a", 160), false, 1, false},
+		{"161 septets", strings.Repeat("a", 161), false, 2, false},
+		{"2x153 septets", strings.Repeat("a", 306), false, 2, false},
+		{"2x153+1 septets", strings.Repeat("a", 307), false, 3, false},
+		{"80 escapes", strings.Repeat("€", 80), false, 1, false},
+		{"80 escapes and one", strings.Repeat("€", 80) + "a", false, 2, false},
+		{"159 and escape", strings.Repeat("a", 159) + "€", false, 2, false},
+		{"escape not split", strings.Repeat("a", 152) + "€" + strings.Repeat("a", 152), false, 3, false},
+		{"70 units", strings.Repeat("ж", 70), false, 1, true},
+		{"71 units", strings.Repeat("ж", 71), false, 2, true},
+		{"2x67 units", strings.Repeat("ж", 134), false, 2, true},
+		{"2x67+1 units", strings.Repeat("ж", 135), false, 3, true},
+		{"35 surrogate pairs", strings.Repeat("😀", 35), false, 1, true},
+		{"36 surrogate pairs", strings.Repeat("😀", 36), false, 2, true},
+		{"surrogate pair not split", strings.Repeat("ж", 66) + "😀" + strings.Repeat("ж", 66), false, 3, true},
+		{"forced 70", strings.Repeat("a", 70), true, 1, true},
+		{"forced 71", strings.Repeat("a", 71), true, 2, true},
+		{"forced 160", strings.Repeat("a", 160), true, 3, true},
+	}
+
+	for _, tt := range tests {
+		parts, ucs2 := countParts(tt.text, tt.unicode)
+		if parts != tt.parts || ucs2 != tt.ucs2 {
+			t.Errorf("%s: countParts = %d, %v, want %d, %v", tt.name, parts, ucs2, tt.parts, tt.ucs2)
+		}
+	}
+}
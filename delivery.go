@@ -0,0 +1,154 @@
+package gsm
+
+import (
+	"sync"
+	"time"
+)
+
+// Result of a sent message
+type SendResult struct {
+	Number     string
+	References []int // message reference (TP-MR) of each part, in order
+	Sent       time.Time
+}
+
+// Returns number of parts sent
+func (r *SendResult) Parts() int {
+	return len(r.References)
+}
+
+// Delivery status from a status report
+type DeliveryStatus int
+
+const (
+	DeliveryPending   DeliveryStatus = iota // temporary error, service centre still trying
+	DeliveryDelivered                       // received by the recipient
+	DeliveryExpired                         // validity period expired
+	DeliveryRejected                        // permanent error, service centre gave up
+)
+
+func (s DeliveryStatus) String() string {
+	switch s {
+	case DeliveryPending:
+		return "pending"
+	case DeliveryDelivered:
+		return "delivered"
+	case DeliveryExpired:
+		return "expired"
+	case DeliveryRejected:
+		return "rejected"
+	}
+	return "unknown"
+}
+
+// Returns delivery status for TP-ST value, see 3GPP TS 23.040 9.2.3.15
+func deliveryStatus(st int) DeliveryStatus {
+	switch {
+	case st < 0x20:
+		return DeliveryDelivered
+	case st < 0x40:
+		return DeliveryPending
+	case st == 0x46:
+		return DeliveryExpired
+	}
+	return DeliveryRejected
+}
+
+// Status report matched to the message it reports on
+type DeliveryReport struct {
+	Number     string // recipient
+	Reference  int    // message reference (TP-MR) of the reported part
+	Status     DeliveryStatus
+	TPStatus   int       // raw TP-ST value
+	SMSCTime   time.Time // service centre timestamp
+	Discharged time.Time // time of delivery or last attempt
+
+	Result *SendResult // matched send, nil if not sent by this instance
+	Part   int         // index of the part in Result.References
+}
+
+// Returns true once the status will not change
+func (r *DeliveryReport) Final() bool {
+	return r.Status != DeliveryPending
+}
+
+// Builds delivery report from a status report message
+func newDeliveryReport(m *Message) *DeliveryReport {
+	return &DeliveryReport{
+		Number:     m.Number,
+		Reference:  m.MessageReference,
+		Status:     deliveryStatus(m.DeliveryStatus),
+		TPStatus:   m.DeliveryStatus,
+		SMSCTime:   m.SMSCTime,
+		Discharged: m.DateTime,
+		Part:       -1,
+	}
+}
+
+// Matches status reports to sent messages by message reference
+type deliveryTracker struct {
+	sync.Mutex
+	pending map[int]*SendResult
+}
+
+// Remembers references of a sent message, older sends with the same reference are dropped
+func (t *deliveryTracker) add(r *SendResult) {
+	t.Lock()
+	defer t.Unlock()
+
+	if t.pending == nil {
+		t.pending = make(map[int]*SendResult)
+	}
+	for _, ref := range r.References {
+		t.pending[ref] = r
+	}
+}
+
+// Sets Result and Part of the report if it matches a sent message
+func (t *deliveryTracker) match(report *DeliveryReport) {
+	t.Lock()
+	defer t.Unlock()
+
+	r, ok := t.pending[report.Reference]
+	if !ok || !numbersMatch(r.Number, report.Number) {
+		return
+	}
+
+	report.Result = r
+	for i, ref := range r.References {
+		if ref == report.Reference {
+			report.Part = i
+		}
+	}
+
+	if report.Final() {
+		delete(t.pending, report.Reference)
+	}
+}
+
+// Compares phone numbers ignoring formatting and international prefix
+func numbersMatch(a, b string) bool {
+	a, b = digits(a), digits(b)
+	if len(a) > len(b) {
+		a, b = b, a
+	}
+	if len(a) == 0 {
+		return len(b) == 0
+	}
+	// national and international forms share the subscriber number
+	if len(a) < len(b) && a[0] == '0' {
+		a = a[1:]
+	}
+	return len(b) >= len(a) && b[len(b)-len(a):] == a
+}
+
+// Returns only the digits of s
+func digits(s string) string {
+	d := make([]byte, 0, len(s))
+	for i := 0; i < len(s); i++ {
+		if s[i] >= '0' && s[i] <= '9' {
+			d = append(d, s[i])
+		}
+	}
+	return string(d)
+}
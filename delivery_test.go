@@ -0,0 +1,107 @@
+package gsm
+
+import (
+	"testing"
+)
+
+func TestDeliveryStatus(t *testing.T) {
+	tests := []struct {
+		st   int
+		want DeliveryStatus
+	}{
+		{0x00, DeliveryDelivered},
+		{0x02, DeliveryDelivered}, // replaced by the service centre
+		{0x1F, DeliveryDelivered},
+		{0x20, DeliveryPending}, // congestion, still trying
+		{0x25, DeliveryPending},
+		{0x3F, DeliveryPending},
+		{0x40, DeliveryRejected}, // remote procedure error
+		{0x46, DeliveryExpired},
+		{0x5F, DeliveryRejected},
+		{0x60, DeliveryRejected}, // temporary error, no more attempts
+		{0x65, DeliveryRejected},
+		{0x7F, DeliveryRejected},
+	}
+
+	for _, tt := range tests {
+		if got := deliveryStatus(tt.st); got != tt.want {
+			t.Errorf("deliveryStatus(%#x) = %v, want %v", tt.st, got, tt.want)
+		}
+		if final := (&DeliveryReport{Status: tt.want}).Final(); final != (tt.want != DeliveryPending) {
+			t.Errorf("TP-ST %#x: Final = %v", tt.st, final)
+		}
+	}
+}
+
+func TestNumbersMatch(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want bool
+	}{
+		{"+381641234567", "+381641234567", true},
+		{"+381641234567", "381641234567", true},
+		{"+381641234567", "0641234567", true},
+		{"0641234567", "+381641234567", true},
+		{"+44 (20) 7946-0018", "+442079460018", true},
+		{"1234", "1234", true},
+		{"", "", true},
+		{"+381641234567", "0641234568", false},
+		{"+381641234567", "+381651234567", false},
+		{"1234", "", false},
+		{"", "+1", false},
+	}
+
+	for _, tt := range tests {
+		if got := numbersMatch(tt.a, tt.b); got != tt.want {
+			t.Errorf("numbersMatch(%q, %q) = %v, want %v", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestDeliveryTracker(t *testing.T) {
+	var tracker deliveryTracker
+	sent := &SendResult{Number: "+381641234567", References: []int{5, 6}}
+	tracker.add(sent)
+
+	// temporary error keeps the send pending
+	report := &DeliveryReport{Number: "0641234567", Reference: 6, Status: deliveryStatus(0x30), Part: -1}
+	tracker.match(report)
+	if report.Result != sent || report.Part != 1 {
+		t.Fatalf("pending report matched %v, part %d", report.Result, report.Part)
+	}
+
+	report = &DeliveryReport{Number: "+381641234567", Reference: 6, Status: deliveryStatus(0x00), Part: -1}
+	tracker.match(report)
+	if report.Result != sent || report.Part != 1 {
+		t.Fatalf("final report matched %v, part %d", report.Result, report.Part)
+	}
+
+	// a final report removes the reference
+	report = &DeliveryReport{Number: "+381641234567", Reference: 6, Status: DeliveryDelivered, Part: -1}
+	tracker.match(report)
+	if report.Result != nil || report.Part != -1 {
+		t.Errorf("report after final matched %v, part %d", report.Result, report.Part)
+	}
+
+	// other recipient with the same reference
+	report = &DeliveryReport{Number: "+381651234567", Reference: 5, Status: DeliveryDelivered, Part: -1}
+	tracker.match(report)
+	if report.Result != nil {
+		t.Errorf("report for other number matched %v", report.Result)
+	}
+
+	// newer send with a reused reference replaces the older one
+	newer := &SendResult{Number: "+381641234567", References: []int{5}}
+	tracker.add(newer)
+	report = &DeliveryReport{Number: "+381641234567", Reference: 5, Status: DeliveryRejected, Part: -1}
+	tracker.match(report)
+	if report.Result != newer || report.Part != 0 {
+		t.Errorf("reused reference matched %v, part %d", report.Result, report.Part)
+	}
+
+	report = &DeliveryReport{Number: "+1", Reference: 99, Part: -1}
+	tracker.match(report)
+	if report.Result != nil {
+		t.Errorf("unknown reference matched %v", report.Result)
+	}
+}
@@ -0,0 +1,205 @@
+package gsm
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const probeTimeout = 2 * time.Second
+
+// Serial ports scanned by Detect
+var detectPatterns = []string{
+	"/dev/serial/by-id/*",
+	"/dev/ttyUSB*",
+	"/dev/ttyACM*",
+}
+
+// AT capable port found by Detect
+type DetectedPort struct {
+	Device       string // /dev/serial/by-id link if there is one, stable across reboots
+	Port         string // tty the device resolves to, e.g. /dev/ttyUSB2
+	Manufacturer string
+	Model        string
+	IMEI         string
+}
+
+// Returns name as written by gammu-detect, manufacturer and model
+func (p *DetectedPort) Name() string {
+	return strings.TrimSpace(p.Manufacturer + " " + p.Model)
+}
+
+// Returns gammu config section for the port, section 0 is [gammu]
+func (p *DetectedPort) Config(section int) string {
+	var b strings.Builder
+	if section == 0 {
+		b.WriteString("[gammu]\n")
+	} else {
+		fmt.Fprintf(&b, "[gammu%d]\n", section)
+	}
+	fmt.Fprintf(&b, "device = %s\n", p.Device)
+	if name := p.Name(); name != "" {
+		fmt.Fprintf(&b, "name = %s\n", name)
+	}
+	b.WriteString("connection = at\n")
+	return b.String()
+}
+
+// Writes gammu config with a section for each port, in order
+func WriteConfig(w io.Writer, ports []*DetectedPort) error {
+	for i, p := range ports {
+		if i > 0 {
+			if _, err := io.WriteString(w, "\n"); err != nil {
+				return err
+			}
+		}
+		if _, err := io.WriteString(w, p.Config(i)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Scans serial ports of USB modems and returns those answering AT commands.
+//
+// Ports are probed with AT, ATI, AT+CGMI and AT+CGSN, a port in use by
+// another program may answer garbage or not at all.
+func Detect() ([]*DetectedPort, error) {
+	return DetectContext(context.Background())
+}
+
+// Same as Detect, stops probing when ctx is done
+func DetectContext(ctx context.Context) ([]*DetectedPort, error) {
+	ports, err := serialPorts()
+	if err != nil {
+		return nil, err
+	}
+	return ProbePorts(ctx, ports...), nil
+}
+
+// Probes devices in parallel, returns those answering AT commands in the order given
+func ProbePorts(ctx context.Context, devices ...string) []*DetectedPort {
+	found := make([]*DetectedPort, len(devices))
+
+	var wg sync.WaitGroup
+	for i, device := range devices {
+		wg.Add(1)
+		go func(i int, device string) {
+			defer wg.Done()
+			p, err := probe(ctx, device)
+			if err != nil {
+				log.Printf("--- Probe %s: %s", device, err)
+				return
+			}
+			found[i] = p
+		}(i, device)
+	}
+	wg.Wait()
+
+	var ports []*DetectedPort
+	for _, p := range found {
+		if p != nil {
+			ports = append(ports, p)
+		}
+	}
+	return ports
+}
+
+// Returns ports matching detectPatterns, by-id links replace the tty they point to
+func serialPorts() (ports []string, err error) {
+	seen := make(map[string]bool)
+	for _, pattern := range detectPatterns {
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, err
+		}
+		sort.Strings(matches)
+
+		for _, path := range matches {
+			resolved, err := filepath.EvalSymlinks(path)
+			if err != nil {
+				continue
+			}
+			if seen[resolved] {
+				continue
+			}
+			seen[resolved] = true
+			ports = append(ports, path)
+		}
+	}
+	return
+}
+
+// Opens device and asks for identification, error if it does not answer AT
+func probe(ctx context.Context, device string) (p *DetectedPort, err error) {
+	port := device
+	if !strings.Contains(device, "://") {
+		if port, err = filepath.EvalSymlinks(device); err != nil {
+			return
+		}
+	}
+
+	m, err := NewModem(device)
+	if err != nil {
+		return
+	}
+	defer m.Close()
+
+	ctx, cancel := context.WithTimeout(ctx, probeTimeout)
+	defer cancel()
+
+	if _, err = m.Exec(ctx, "AT"); err != nil {
+		return
+	}
+
+	p = &DetectedPort{Device: device, Port: port}
+	if r, e := m.Exec(ctx, "AT+CGMI"); e == nil {
+		p.Manufacturer = infoValue(r.Lines, "+CGMI")
+	}
+	if r, e := m.Exec(ctx, "ATI"); e == nil {
+		p.Model = modelFromATI(r.Lines, p.Manufacturer)
+	}
+	if r, e := m.Exec(ctx, "AT+CGSN"); e == nil {
+		p.IMEI = infoValue(r.Lines, "+CGSN")
+	}
+	return
+}
+
+// Returns first line of an identification response, without the optional prefix and quotes
+func infoValue(lines []string, prefix string) string {
+	for _, line := range lines {
+		line = strings.TrimSpace(strings.TrimPrefix(line, prefix+":"))
+		line = strings.Trim(line, `"`)
+		if line != "" {
+			return line
+		}
+	}
+	return ""
+}
+
+// Returns model from ATI response, either a "Model:" line or the first line
+// that is not the manufacturer or a revision
+func modelFromATI(lines []string, manufacturer string) string {
+	model := ""
+	for _, line := range lines {
+		line = strings.TrimSpace(line)
+		lower := strings.ToLower(line)
+		switch {
+		case strings.HasPrefix(lower, "model:"):
+			return strings.TrimSpace(line[len("model:"):])
+		case line == "", strings.EqualFold(line, manufacturer), strings.HasPrefix(lower, "manufacturer:"),
+			strings.HasPrefix(lower, "revision:"), strings.HasPrefix(lower, "imei:"):
+			continue
+		}
+		if model == "" {
+			model = line
+		}
+	}
+	return model
+}
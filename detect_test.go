@@ -0,0 +1,85 @@
+package gsm
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestWriteConfig(t *testing.T) {
+	ports := []*DetectedPort{
+		{Device: "/dev/serial/by-id/usb-HUAWEI-if00-port0", Manufacturer: "huawei", Model: "E1750"},
+		{Device: "/dev/ttyACM0"},
+	}
+
+	var b strings.Builder
+	if err := WriteConfig(&b, ports); err != nil {
+		t.Fatal(err)
+	}
+	want := "[gammu]\n" +
+		"device = /dev/serial/by-id/usb-HUAWEI-if00-port0\n" +
+		"name = huawei E1750\n" +
+		"connection = at\n" +
+		"\n" +
+		"[gammu1]\n" +
+		"device = /dev/ttyACM0\n" +
+		"connection = at\n"
+	if b.String() != want {
+		t.Errorf("config =\n%s\nwant\n%s", b.String(), want)
+	}
+
+	if err := WriteConfig(failingWriter{}, ports); err == nil {
+		t.Error("write error not returned")
+	}
+}
+
+type failingWriter struct{}
+
+func (failingWriter) Write([]byte) (int, error) {
+	return 0, errors.New("write failed")
+}
+
+func TestModelFromATI(t *testing.T) {
+	tests := []struct {
+		name         string
+		lines        []string
+		manufacturer string
+		model        string
+	}{
+		{"model line", []string{"Manufacturer: huawei", "Model: E1750", "Revision: 11.126"}, "huawei", "E1750"},
+		{"model line lower case", []string{"model:  SIM800 R14.18"}, "", "SIM800 R14.18"},
+		{"plain lines", []string{"SIMCOM_Ltd", "SIMCOM_SIM800", "Revision:1418B04SIM800"}, "SIMCOM_Ltd", "SIMCOM_SIM800"},
+		{"manufacturer case", []string{"", "QUALCOMM", "MF190", "IMEI: 123"}, "qualcomm", "MF190"},
+		{"first of several", []string{"Quectel", "EC25", "EC25EFA"}, "Quectel", "EC25"},
+		{"nothing", []string{"Revision: 1.0", ""}, "", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := modelFromATI(tt.lines, tt.manufacturer); got != tt.model {
+				t.Errorf("modelFromATI = %q, want %q", got, tt.model)
+			}
+		})
+	}
+}
+
+func TestInfoValue(t *testing.T) {
+	tests := []struct {
+		lines  []string
+		prefix string
+		value  string
+	}{
+		{[]string{"356938035643809"}, "+CGSN", "356938035643809"},
+		{[]string{"+CGSN: 356938035643809"}, "+CGSN", "356938035643809"},
+		{[]string{`+CGMI: "huawei"`}, "+CGMI", "huawei"},
+		{[]string{"", "  ", "SIMCOM_Ltd"}, "+CGMI", "SIMCOM_Ltd"},
+		{[]string{"^ICCID: 89860000000000000001"}, "^ICCID", "89860000000000000001"},
+		{nil, "+CIMI", ""},
+	}
+
+	for _, tt := range tests {
+		if got := infoValue(tt.lines, tt.prefix); got != tt.value {
+			t.Errorf("infoValue(%q, %s) = %q, want %q", tt.lines, tt.prefix, got, tt.value)
+		}
+	}
+}
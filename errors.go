@@ -0,0 +1,199 @@
+package gsm
+
+import (
+	"context"
+	"errors"
+)
+
+// Error code, independent of the backend reporting it
+type ErrorCode int
+
+const (
+	CodeUnknown ErrorCode = iota
+	CodeTimeout
+	CodeEmpty
+	CodeNotConnected
+	CodeSecurity
+	CodeDeviceOpen
+	CodeDeviceBusy
+	CodeDeviceLocked
+	CodeDeviceNotExist
+	CodeDevicePermission
+	CodeDeviceIO
+	CodeNotSupported
+	CodeNotImplemented
+	CodeInvalidLocation
+	CodeInvalidData
+	CodeFull
+	CodeMemory
+	CodeNoSIM
+	CodePhoneOff
+	CodeCanceled
+	CodeBusy
+	CodeNetwork
+	CodeEmptySMSC
+	CodeUnknownResponse
+)
+
+var codeNames = map[ErrorCode]string{
+	CodeUnknown:          "unknown error",
+	CodeTimeout:          "timeout",
+	CodeEmpty:            "empty",
+	CodeNotConnected:     "not connected",
+	CodeSecurity:         "security code required",
+	CodeDeviceOpen:       "cannot open device",
+	CodeDeviceBusy:       "device busy",
+	CodeDeviceLocked:     "device locked",
+	CodeDeviceNotExist:   "device does not exist",
+	CodeDevicePermission: "no permission to open device",
+	CodeDeviceIO:         "device read or write error",
+	CodeNotSupported:     "not supported",
+	CodeNotImplemented:   "not implemented",
+	CodeInvalidLocation:  "invalid location",
+	CodeInvalidData:      "invalid data",
+	CodeFull:             "memory full",
+	CodeMemory:           "out of memory",
+	CodeNoSIM:            "no SIM card",
+	CodePhoneOff:         "phone is off",
+	CodeCanceled:         "canceled",
+	CodeBusy:             "busy",
+	CodeNetwork:          "network error",
+	CodeEmptySMSC:        "no SMSC number",
+	CodeUnknownResponse:  "unknown response",
+}
+
+func (c ErrorCode) String() string {
+	if s, ok := codeNames[c]; ok {
+		return s
+	}
+	return codeNames[CodeUnknown]
+}
+
+// Error reported by the phone or library.
+//
+// Errors match the sentinel errors below with errors.Is by code.
+type Error struct {
+	Code ErrorCode
+	Op   string // operation that failed, empty for sentinel errors
+	Msg  string // backend message, code description if empty
+}
+
+func (e *Error) Error() string {
+	msg := e.Msg
+	if msg == "" {
+		msg = e.Code.String()
+	}
+	if e.Op == "" {
+		return msg
+	}
+	return e.Op + ": " + msg
+}
+
+// Reports whether target is an *Error with the same code
+func (e *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	return ok && t.Code == e.Code
+}
+
+// Reports whether the operation may succeed if retried
+func (e *Error) Temporary() bool {
+	switch e.Code {
+	case CodeTimeout, CodeNotConnected, CodeDeviceBusy, CodeDeviceLocked, CodeDeviceIO,
+		CodeBusy, CodeNetwork, CodeUnknownResponse:
+		return true
+	}
+	return false
+}
+
+// Reports whether the error is a timeout
+func (e *Error) Timeout() bool {
+	return e.Code == CodeTimeout
+}
+
+// Sentinel errors, compare with errors.Is
+var (
+	ErrUnknown          = &Error{Code: CodeUnknown}
+	ErrTimeout          = &Error{Code: CodeTimeout}
+	ErrEmpty            = &Error{Code: CodeEmpty}
+	ErrNotConnected     = &Error{Code: CodeNotConnected}
+	ErrSecurity         = &Error{Code: CodeSecurity}
+	ErrDeviceOpen       = &Error{Code: CodeDeviceOpen}
+	ErrDeviceBusy       = &Error{Code: CodeDeviceBusy}
+	ErrDeviceLocked     = &Error{Code: CodeDeviceLocked}
+	ErrDeviceNotExist   = &Error{Code: CodeDeviceNotExist}
+	ErrDevicePermission = &Error{Code: CodeDevicePermission}
+	ErrDeviceIO         = &Error{Code: CodeDeviceIO}
+	ErrNotSupported     = &Error{Code: CodeNotSupported}
+	ErrNotImplemented   = &Error{Code: CodeNotImplemented}
+	ErrInvalidLocation  = &Error{Code: CodeInvalidLocation}
+	ErrInvalidData      = &Error{Code: CodeInvalidData}
+	ErrFull             = &Error{Code: CodeFull}
+	ErrMemory           = &Error{Code: CodeMemory}
+	ErrNoSIM            = &Error{Code: CodeNoSIM}
+	ErrPhoneOff         = &Error{Code: CodePhoneOff}
+	ErrCanceled         = &Error{Code: CodeCanceled}
+	ErrBusy             = &Error{Code: CodeBusy}
+	ErrNetwork          = &Error{Code: CodeNetwork}
+	ErrEmptySMSC        = &Error{Code: CodeEmptySMSC}
+	ErrUnknownResponse  = &Error{Code: CodeUnknownResponse}
+)
+
+// Reports whether err may go away if the operation is retried
+func IsTemporary(err error) bool {
+	var t interface{ Temporary() bool }
+	if errors.As(err, &t) {
+		return t.Temporary()
+	}
+	return errors.Is(err, context.DeadlineExceeded)
+}
+
+// Reports whether err matches an *Error with one of the codes
+func isCode(err error, codes ...ErrorCode) bool {
+	for _, c := range codes {
+		if errors.Is(err, &Error{Code: c}) {
+			return true
+		}
+	}
+	return false
+}
+
+// TimeoutError is returned when an operation runs past its context deadline
+type TimeoutError struct {
+	Op  string
+	Err error
+}
+
+func (e *TimeoutError) Error() string {
+	return e.Op + ": timeout: " + e.Err.Error()
+}
+
+// Timeout reports whether the error is a timeout, satisfies net.Error style checks
+func (e *TimeoutError) Timeout() bool {
+	return true
+}
+
+// Temporary reports true, the operation may succeed with a longer deadline
+func (e *TimeoutError) Temporary() bool {
+	return true
+}
+
+// Is matches ErrTimeout
+func (e *TimeoutError) Is(target error) bool {
+	return target == ErrTimeout
+}
+
+func (e *TimeoutError) Unwrap() error {
+	return e.Err
+}
+
+// Returns nil if ctx is still alive, TimeoutError on deadline or the context error on cancellation
+func contextError(ctx context.Context, op string) error {
+	err := ctx.Err()
+	if err == nil {
+		return nil
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return &TimeoutError{Op: op, Err: err}
+	}
+	return err
+}
@@ -0,0 +1,120 @@
+package gsm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+var sentinels = []*Error{
+	ErrUnknown, ErrTimeout, ErrEmpty, ErrNotConnected, ErrSecurity, ErrDeviceOpen,
+	ErrDeviceBusy, ErrDeviceLocked, ErrDeviceNotExist, ErrDevicePermission, ErrDeviceIO,
+	ErrNotSupported, ErrNotImplemented, ErrInvalidLocation, ErrInvalidData, ErrFull,
+	ErrMemory, ErrNoSIM, ErrPhoneOff, ErrCanceled, ErrBusy, ErrNetwork, ErrEmptySMSC,
+	ErrUnknownResponse,
+}
+
+func TestErrorIs(t *testing.T) {
+	if len(sentinels) != len(codeNames) {
+		t.Fatalf("%d sentinels for %d codes", len(sentinels), len(codeNames))
+	}
+
+	for _, sentinel := range sentinels {
+		err := fmt.Errorf("wrapped: %w", &Error{Code: sentinel.Code, Op: "send sms", Msg: "backend message"})
+		for _, target := range sentinels {
+			if got := errors.Is(err, target); got != (target == sentinel) {
+				t.Errorf("errors.Is(%v, %v) = %v", sentinel.Code, target.Code, got)
+			}
+		}
+
+		var e *Error
+		if !errors.As(err, &e) || e.Code != sentinel.Code {
+			t.Errorf("errors.As(%v) = %v", sentinel.Code, e)
+		}
+	}
+
+	if errors.Is(&Error{Code: CodeBusy}, errors.New("busy")) {
+		t.Error("*Error matches a plain error")
+	}
+}
+
+func TestErrorString(t *testing.T) {
+	tests := []struct {
+		err  *Error
+		want string
+	}{
+		{ErrNoSIM, "no SIM card"},
+		{&Error{Code: CodeNoSIM, Op: "send sms"}, "send sms: no SIM card"},
+		{&Error{Code: CodeNoSIM, Op: "send sms", Msg: "SIM not inserted"}, "send sms: SIM not inserted"},
+		{&Error{Code: ErrorCode(99)}, "unknown error"},
+	}
+
+	for _, tt := range tests {
+		if got := tt.err.Error(); got != tt.want {
+			t.Errorf("Error() = %q, want %q", got, tt.want)
+		}
+	}
+}
+
+func TestTemporary(t *testing.T) {
+	temporary := map[ErrorCode]bool{
+		CodeTimeout: true, CodeNotConnected: true, CodeDeviceBusy: true, CodeDeviceLocked: true,
+		CodeDeviceIO: true, CodeBusy: true, CodeNetwork: true, CodeUnknownResponse: true,
+	}
+
+	for _, sentinel := range sentinels {
+		err := &Error{Code: sentinel.Code, Op: "read sms"}
+		if got := err.Temporary(); got != temporary[sentinel.Code] {
+			t.Errorf("%v: Temporary = %v", sentinel.Code, got)
+		}
+		if got := IsTemporary(fmt.Errorf("wrapped: %w", err)); got != temporary[sentinel.Code] {
+			t.Errorf("%v: IsTemporary = %v", sentinel.Code, got)
+		}
+		if got := err.Timeout(); got != (sentinel.Code == CodeTimeout) {
+			t.Errorf("%v: Timeout = %v", sentinel.Code, got)
+		}
+	}
+
+	if IsTemporary(errors.New("plain")) || IsTemporary(nil) || IsTemporary(context.Canceled) {
+		t.Error("IsTemporary reports an unrelated error")
+	}
+	if !IsTemporary(context.DeadlineExceeded) {
+		t.Error("IsTemporary(context.DeadlineExceeded) = false")
+	}
+}
+
+func TestContextError(t *testing.T) {
+	if err := contextError(context.Background(), "send sms"); err != nil {
+		t.Errorf("live context err = %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Nanosecond)
+	defer cancel()
+	<-ctx.Done()
+
+	err := contextError(ctx, "send sms")
+	var te *TimeoutError
+	if !errors.As(err, &te) || te.Op != "send sms" {
+		t.Fatalf("err = %#v, want *TimeoutError", err)
+	}
+	if !errors.Is(err, ErrTimeout) || !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("%v matches neither ErrTimeout nor context.DeadlineExceeded", err)
+	}
+	if errors.Is(err, ErrBusy) {
+		t.Errorf("%v matches ErrBusy", err)
+	}
+	if !te.Timeout() || !te.Temporary() || !IsTemporary(err) {
+		t.Errorf("%v is not a temporary timeout", err)
+	}
+	if want := "send sms: timeout: context deadline exceeded"; err.Error() != want {
+		t.Errorf("Error() = %q, want %q", err.Error(), want)
+	}
+
+	ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+	if err := contextError(ctx, "send sms"); err != context.Canceled {
+		t.Errorf("canceled context err = %v, want %v", err, context.Canceled)
+	}
+}
@@ -1,11 +1,13 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"os"
 	"os/user"
 	"path/filepath"
+	"time"
 
 	gsm "github.com/gemaalief/gsmgo"
 )
@@ -13,11 +15,12 @@ import (
 func main() {
 	cfg := flag.String("config", "", "Config file")
 	debug := flag.Bool("debug", false, "Enable debugging")
-	mode := flag.String("mode", "sms", "select mode : [sms | ussd]")
+	mode := flag.String("mode", "sms", "select mode : [sms | ussd | read | info | receive | smsd | detect]")
 	code := flag.String("code", "", "ussd code")
 	text := flag.String("text", "", "Text Message")
 	number := flag.String("number", "", "Phone Number")
 	sectionPtr := flag.Int("section", 0, "called gammu section")
+	device := flag.String("device", "", "AT modem device, tcp://host:port or rfc2217://host:port, used without gammu, serial settings are read from config")
 	flag.Parse()
 
 	if *mode == "sms" {
@@ -25,11 +28,6 @@ func main() {
 			flag.Usage()
 			os.Exit(1)
 		}
-
-		if len(*text) > 160 {
-			fmt.Println("Message exceeds 160 characters")
-			os.Exit(1)
-		}
 	} else if *mode == "ussd" {
 		if *code == "" {
 			flag.Usage()
@@ -41,14 +39,116 @@ func main() {
 
 		return
 	}
+	if *mode == "detect" {
+		ports, err := gsm.Detect()
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		if len(ports) == 0 {
+			fmt.Println("No modem found")
+			os.Exit(1)
+		}
+		gsm.WriteConfig(os.Stdout, ports)
+
+		return
+	}
+
+	var b gsm.Backend
+	var g *gsm.GSM
+	if *device != "" {
+		config := gsm.ModemConfig{Device: *device}
+		if *cfg != "" {
+			var err error
+			config, err = gsm.ReadModemConfig(*cfg, *sectionPtr)
+			if err != nil {
+				fmt.Printf("Error: %v\n", err)
+				os.Exit(1)
+			}
+			config.Device = *device
+		}
+		m, err := gsm.NewModemWithConfig(config)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		b = gsm.NewATBackend(m)
+	} else {
+		g = connect(*cfg, *debug, *sectionPtr)
+		b = g
+	}
+	defer b.Terminate()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	if *mode == "sms" {
+		result, err := b.SendContext(ctx, *text, *number)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+		} else {
+			fmt.Printf("Sent %d part(s)\n", result.Parts())
+		}
+	} else if *mode == "ussd" {
+		result, err := b.USSDContext(ctx, *code)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+		} else {
+			fmt.Println(result.Text)
+		}
+	} else if *mode == "read" {
+		result, err := b.ReadSMSContext(ctx, false)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+		}
+		for _, msg := range result {
+			fmt.Printf("%s : %s\n", msg.Number, msg.Text)
+		}
+	} else if *mode == "info" {
+		if g != nil {
+			info, err := g.Info()
+			if err != nil {
+				fmt.Printf("Error: %v\n", err)
+			} else {
+				fmt.Printf("%s %s (%s)\nIMEI: %s\nIMSI: %s\n", info.Manufacturer, info.Model, info.Firmware, info.IMEI, info.IMSI)
+			}
+		}
+		status, err := b.Status()
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+		} else {
+			fmt.Printf("Network: %s %s (%s), LAC %s, cell %s\nSignal: %d dBm, %d%%\n", status.OperatorName, status.OperatorCode,
+				status.Network, status.LAC, status.CellID, status.SignalStrength, status.SignalPercent)
+		}
+	} else if *mode == "receive" {
+		received := make(chan struct{}, 1)
+		b.SetMessageHandler(func(msg *gsm.Message) error {
+			fmt.Println(msg.Number + " - " + msg.Text)
+			select {
+			case received <- struct{}{}:
+			default:
+			}
+			return nil
+		})
+		if g != nil {
+			err := g.WaitForSMS(1)
+			if err != nil {
+				fmt.Printf("Error: %v\n", err)
+			}
+		}
+		<-received
+	}
+}
 
+// Returns GSM connected with gammu config
+func connect(cfg string, debug bool, section int) *gsm.GSM {
 	g, err := gsm.NewGSM()
 	if err != nil {
 		fmt.Println(err)
+		os.Exit(1)
 	}
-	defer g.Terminate()
 
-	if *debug {
+	if debug {
 		g.EnableDebug()
 	}
 
@@ -61,8 +161,8 @@ func main() {
 	}
 
 	var config string
-	if *cfg != "" {
-		config = *cfg
+	if cfg != "" {
+		config = cfg
 	} else if _, err := os.Stat("/etc/gsmgo.conf"); err == nil {
 		config = "/etc/gsmgo.conf"
 	} else if _, err := os.Stat(filepath.Join(homedir, ".gsmgo.conf")); err == nil {
@@ -74,11 +174,6 @@ func main() {
 		os.Exit(1)
 	}
 
-	var section int
-	if *sectionPtr != 0 {
-		section = *sectionPtr
-	}
-
 	err = g.SetConfig(config, section)
 	if err != nil {
 		fmt.Printf("Error: %v\n", err)
@@ -93,36 +188,5 @@ func main() {
 		fmt.Println("Phone is not connected")
 		os.Exit(1)
 	}
-
-	if *mode == "sms" {
-		err = g.SendSMS(*text, *number)
-		if err != nil {
-			fmt.Printf("Error: %v\n", err)
-		}
-	} else if *mode == "ussd" {
-		result, err := g.GetUSSDByCode(*code, "")
-		if err != nil {
-			fmt.Printf("Error: %v\n", err)
-		}
-		fmt.Println(result)
-	} else if *mode == "read" {
-		result, err := g.ReadSMS(false)
-		if err != nil {
-			fmt.Printf("Error: %v\n", err)
-		}
-		for _, msg := range result {
-			fmt.Printf("%s : %s\n", msg.Number, msg.Text)
-		}
-	} else if *mode == "receive" {
-		cb := func(tes, tes2 string) error {
-			fmt.Println(tes + " - " + tes2)
-			return nil
-		}
-		g.SetCallBack(cb)
-		err := g.WaitForSMS(1)
-		if err != nil {
-			fmt.Printf("Error: %v\n", err)
-		}
-		g.AlwaysReadUntilBreak()
-	}
+	return g
 }
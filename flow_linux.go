@@ -0,0 +1,30 @@
+package gsm
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// Turns on RTS/CTS flow control of the serial device.
+//
+// tarm/serial has no flow control setting. Termios settings belong to the
+// device, so they are changed through a second descriptor.
+func setRTSCTS(device string) error {
+	f, err := os.OpenFile(device, os.O_RDWR|unix.O_NOCTTY|unix.O_NONBLOCK, 0)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	fd := int(f.Fd())
+	t, err := unix.IoctlGetTermios(fd, unix.TCGETS)
+	if err != nil {
+		return &Error{Code: CodeDeviceOpen, Op: "flow control", Msg: err.Error()}
+	}
+	t.Cflag |= unix.CRTSCTS
+	if err = unix.IoctlSetTermios(fd, unix.TCSETS, t); err != nil {
+		return &Error{Code: CodeDeviceOpen, Op: "flow control", Msg: err.Error()}
+	}
+	return nil
+}
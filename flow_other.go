@@ -0,0 +1,8 @@
+//go:build !linux
+
+package gsm
+
+// Hardware flow control is only supported on Linux
+func setRTSCTS(device string) error {
+	return &Error{Code: CodeNotSupported, Op: "flow control"}
+}
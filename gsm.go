@@ -17,32 +17,34 @@ package gsm
 
 // #cgo pkg-config: gammu
 // #include <stdio.h>
+// #include <stdint.h>
+// #include <string.h>
 // #include <gammu.h>
 // extern void sendSMSCallback(GSM_StateMachine *sm, int status, int messageReference, void * user_data);
 // extern void getSMSCallback(GSM_StateMachine *sm, GSM_SMSMessage *sms, void * user_data);
+// extern void getUSSDCallback(GSM_StateMachine *sm, GSM_USSDMessage *ussd, void * user_data);
+//
+// // user_data carries the cgo.Handle of the owning GSM
+// static void setCallbacks(GSM_StateMachine *sm, uintptr_t handle) {
+// 	GSM_SetSendSMSStatusCallback(sm, sendSMSCallback, (void *)handle);
+// 	GSM_SetIncomingSMSCallback(sm, getSMSCallback, (void *)handle);
+// 	GSM_SetIncomingUSSDCallback(sm, getUSSDCallback, (void *)handle);
+// }
 import "C"
 
 import (
 	"context"
-	"errors"
 	"fmt"
 	"log"
+	"runtime"
+	"runtime/cgo"
+	"sync"
 	"time"
+	"unicode/utf16"
 	"unsafe"
-)
-
-type SmsRead struct {
-	Location int
-	Folder   int
-	Number   string
-	Text     string
-}
-
-var smsSendStatus C.GSM_Error
-var smsReadStatus C.GSM_Error
-var smsReceivedStatus C.GSM_Error
 
-var callBack func(number, text string) error
+	"github.com/gemaalief/gsmgo/pdu"
+)
 
 const (
 	ERR_NONE    = C.ERR_NONE
@@ -56,22 +58,116 @@ func errorString(e int) string {
 	return C.GoString(C.GSM_ErrorString(C.GSM_Error(e)))
 }
 
-// Gammu GSM struct
+// Gammu errors with a matching error code, others are CodeUnknown
+var gammuCodes = map[C.GSM_Error]ErrorCode{
+	C.ERR_TIMEOUT:                CodeTimeout,
+	C.ERR_EMPTY:                  CodeEmpty,
+	C.ERR_NOTCONNECTED:           CodeNotConnected,
+	C.ERR_SECURITYERROR:          CodeSecurity,
+	C.ERR_DEVICEOPENERROR:        CodeDeviceOpen,
+	C.ERR_DEVICEBUSY:             CodeDeviceBusy,
+	C.ERR_DEVICELOCKED:           CodeDeviceLocked,
+	C.ERR_DEVICENOTEXIST:         CodeDeviceNotExist,
+	C.ERR_DEVICENOPERMISSION:     CodeDevicePermission,
+	C.ERR_DEVICEREADERROR:        CodeDeviceIO,
+	C.ERR_DEVICEWRITEERROR:       CodeDeviceIO,
+	C.ERR_DEVICECHANGESPEEDERROR: CodeDeviceIO,
+	C.ERR_DEVICEPARITYERROR:      CodeDeviceIO,
+	C.ERR_DEVICEDTRRTSERROR:      CodeDeviceIO,
+	C.ERR_NOTSUPPORTED:           CodeNotSupported,
+	C.ERR_NOTIMPLEMENTED:         CodeNotImplemented,
+	C.ERR_INVALIDLOCATION:        CodeInvalidLocation,
+	C.ERR_INVALIDDATA:            CodeInvalidData,
+	C.ERR_INVALIDDATETIME:        CodeInvalidData,
+	C.ERR_FULL:                   CodeFull,
+	C.ERR_MOREMEMORY:             CodeMemory,
+	C.ERR_MEMORY:                 CodeMemory,
+	C.ERR_NOSIM:                  CodeNoSIM,
+	C.ERR_PHONEOFF:               CodePhoneOff,
+	C.ERR_CANCELED:               CodeCanceled,
+	C.ERR_BUSY:                   CodeBusy,
+	C.ERR_WORKINPROGRESS:         CodeBusy,
+	C.ERR_INSIDEPHONEMENU:        CodeBusy,
+	C.ERR_NETWORK_ERROR:          CodeNetwork,
+	C.ERR_EMPTYSMSC:              CodeEmptySMSC,
+	C.ERR_UNKNOWNRESPONSE:        CodeUnknownResponse,
+	C.ERR_UNKNOWNFRAME:           CodeUnknownResponse,
+	C.ERR_FRAMENOTREQUESTED:      CodeUnknownResponse,
+}
+
+// Returns *Error for gammu error, nil for ERR_NONE
+func newError(op string, e C.GSM_Error) error {
+	if e == ERR_NONE {
+		return nil
+	}
+	return &Error{Code: gammuCodes[e], Op: op, Msg: errorString(int(e))}
+}
+
+// How often the worker polls the device for incoming messages while idle
+const pollInterval = 500 * time.Millisecond
+
+var _ Backend = (*GSM)(nil)
+
+var errTerminated = &Error{Code: CodeNotConnected, Msg: "GSM is terminated"}
+
+// Gammu GSM struct.
+//
+// All libGammu calls are made from a single worker goroutine locked to its
+// OS thread, so GSM methods are safe for concurrent use. Gammu callbacks fire
+// on that thread, user callbacks are run in order on a separate goroutine.
 type GSM struct {
-	sm    *C.GSM_StateMachine
-	modem *Modem
+	sm     *C.GSM_StateMachine
+	handle cgo.Handle
+
+	reqs     chan func()
+	done     chan struct{}
+	once     sync.Once
+	received chan struct{}
+
+	events     []func()
+	eventsLock sync.Mutex
+	eventsCond *sync.Cond
+
+	deliveries deliveryTracker
+
+	// owned by the worker
+	incoming         bool
+	smsSendStatus    C.GSM_Error
+	smsSendReference int
+	ussdWaiting      bool
+	ussdResponse     *USSDResponse
+	callBack         func(number, text string) error
+	messageHandler   func(*Message) error
+	deliveryHandler  func(*DeliveryReport) error
 }
 
 // Returns new GSM
 func NewGSM() (g *GSM, err error) {
-	g = &GSM{}
-	g.sm = C.GSM_AllocStateMachine()
+	g = &GSM{
+		reqs:     make(chan func()),
+		done:     make(chan struct{}),
+		received: make(chan struct{}, 1),
+	}
+	g.eventsCond = sync.NewCond(&g.eventsLock)
+
+	go g.worker()
+	go g.dispatch()
+
+	g.do(func() error {
+		g.sm = C.GSM_AllocStateMachine()
+		return nil
+	})
 
 	if g.sm == nil {
-		err = errors.New("Cannot allocate state machine")
+		close(g.done)
+		g.queue(nil)
+		return nil, &Error{Code: CodeMemory, Op: "new", Msg: "Cannot allocate state machine"}
 	}
 
-	callBack = func(number, text string) error {
+	// handle is passed to gammu as callback user data
+	g.handle = cgo.NewHandle(g)
+
+	g.callBack = func(number, text string) error {
 		log.Printf("%s : %s\n", number, text)
 		return nil
 	}
@@ -79,28 +175,108 @@ func NewGSM() (g *GSM, err error) {
 	return
 }
 
+// Runs requests on a locked OS thread, polls for incoming messages when idle
+func (g *GSM) worker() {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case fn := <-g.reqs:
+			fn()
+		case <-ticker.C:
+			if g.incoming && g.isConnected() {
+				C.GSM_ReadDevice(g.sm, C.gboolean(0))
+			}
+		case <-g.done:
+			return
+		}
+	}
+}
+
+// Runs fn on the worker and waits for it to finish
+func (g *GSM) do(fn func() error) error {
+	return g.doContext(context.Background(), "", fn)
+}
+
+// Like do, gives up if ctx is done before the worker picks fn up
+func (g *GSM) doContext(ctx context.Context, op string, fn func() error) error {
+	result := make(chan error, 1)
+	select {
+	case g.reqs <- func() { result <- fn() }:
+	case <-g.done:
+		return errTerminated
+	case <-ctx.Done():
+		return contextError(ctx, op)
+	}
+	return <-result
+}
+
+// Queues fn to be run by the dispatcher, called from the worker
+func (g *GSM) queue(fn func()) {
+	g.eventsLock.Lock()
+	g.events = append(g.events, fn)
+	g.eventsLock.Unlock()
+	g.eventsCond.Signal()
+}
+
+// Runs queued user callbacks in order, so they may call back into GSM
+func (g *GSM) dispatch() {
+	for {
+		g.eventsLock.Lock()
+		for len(g.events) == 0 {
+			g.eventsCond.Wait()
+		}
+		fn := g.events[0]
+		g.events = g.events[1:]
+		g.eventsLock.Unlock()
+
+		if fn == nil {
+			return
+		}
+		fn()
+	}
+}
+
 // Enables global debugging to stderr
 func (g *GSM) EnableDebug() {
-	debugInfo := C.GSM_GetGlobalDebug()
-	C.GSM_SetDebugFileDescriptor(C.stderr, C.gboolean(1), debugInfo)
-	C.GSM_SetDebugLevel(C.CString("textall"), debugInfo)
+	g.do(func() error {
+		debugInfo := C.GSM_GetGlobalDebug()
+		C.GSM_SetDebugFileDescriptor(C.stderr, C.gboolean(1), debugInfo)
+		level := C.CString("textall")
+		defer C.free(unsafe.Pointer(level))
+		C.GSM_SetDebugLevel(level, debugInfo)
+		return nil
+	})
 }
 
 // Connects to phone
-func (g *GSM) Connect() (err error) {
+func (g *GSM) Connect() error {
+	return g.do(g.connect)
+}
+
+func (g *GSM) connect() (err error) {
 	e := C.GSM_InitConnection(g.sm, 1) // 1 means number of replies to wait for
 	if e != ERR_NONE {
-		err = errors.New(errorString(int(e)))
+		err = newError("connect", e)
 	}
 
-	// set callback for message sending
-	C.GSM_SetSendSMSStatusCallback(g.sm, (C.SendSMSStatusCallback)(unsafe.Pointer(C.sendSMSCallback)), nil)
-	C.GSM_SetIncomingSMSCallback(g.sm, (C.IncomingSMSCallback)(unsafe.Pointer(C.getSMSCallback)), nil)
+	// set callbacks for message sending and receiving
+	C.setCallbacks(g.sm, C.uintptr_t(g.handle))
 	return
 }
 
 // Reads configuration file
-func (g *GSM) SetConfig(config string, section int) (err error) {
+func (g *GSM) SetConfig(config string, section int) error {
+	return g.do(func() error {
+		return g.setConfig(config, section)
+	})
+}
+
+func (g *GSM) setConfig(config string, section int) (err error) {
 	path := C.CString(config)
 	defer C.free(unsafe.Pointer(path))
 
@@ -110,14 +286,14 @@ func (g *GSM) SetConfig(config string, section int) (err error) {
 	// find configuration file
 	e := C.GSM_FindGammuRC(&cfg, path)
 	if e != ERR_NONE {
-		err = errors.New(errorString(int(e)))
+		err = newError("config", e)
 		return
 	}
 
 	// read it
 	e = C.GSM_ReadConfig(cfg, C.GSM_GetConfig(g.sm, 0), C.int(section))
 	if e != ERR_NONE {
-		err = errors.New(errorString(int(e)))
+		err = newError("config", e)
 		return
 	}
 
@@ -126,168 +302,301 @@ func (g *GSM) SetConfig(config string, section int) (err error) {
 	return
 }
 
+// Sends text as a single or multipart message, using UCS-2 if the text does
+// not fit the GSM default alphabet
+func (g *GSM) Send(text, number string) (*SendResult, error) {
+	return g.SendContext(context.Background(), text, number)
+}
+
+// Like Send, waiting for the network reply to each part until ctx is done
+func (g *GSM) SendContext(ctx context.Context, text, number string, opts ...SendOptions) (*SendResult, error) {
+	o := sendOptions(opts)
+
+	parts, unicode := countParts(text, o.Unicode)
+	o.Unicode = unicode
+
+	if parts > 1 {
+		return g.SendLongSMSContext(ctx, text, number, o)
+	}
+	return g.SendSMSContext(ctx, text, number, o)
+}
+
 // Sends message
-func (g *GSM) SendSMS(text, number string) (err error) {
+func (g *GSM) SendSMS(text, number string) error {
+	_, err := g.SendSMSContext(context.Background(), text, number)
+	return err
+}
+
+// Sends message with options
+func (g *GSM) SendSMSWithOptions(text, number string, opts SendOptions) (*SendResult, error) {
+	return g.SendSMSContext(context.Background(), text, number, opts)
+}
+
+// Sends message, waiting for the network reply until ctx is done
+func (g *GSM) SendSMSContext(ctx context.Context, text, number string, opts ...SendOptions) (result *SendResult, err error) {
+	err = g.doContext(ctx, "send sms", func() (e error) {
+		result, e = g.sendSMS(ctx, text, number, sendOptions(opts))
+		return
+	})
+	return
+}
+
+func (g *GSM) sendSMS(ctx context.Context, text, number string, opts SendOptions) (*SendResult, error) {
 	var sms C.GSM_SMSMessage
-	var smsc C.GSM_SMSC
 
-	sms.PDU = C.SMS_Status_Report                    // submit message
 	sms.UDH.Type = C.UDH_NoUDH                       // no UDH, just a plain message
 	sms.Coding = C.SMS_Coding_Default_No_Compression // default coding for text
-	sms.Class = 1                                    // class 1 message (normal)
+	if opts.Unicode || !isGSM7(text) {
+		sms.Coding = C.SMS_Coding_Unicode_No_Compression
+	}
+
+	encodeUnicode(sms.Text[:], text)
+	encodeUnicode(sms.Number[:], number)
 
-	C.EncodeUnicode((*C.uchar)(unsafe.Pointer(&sms.Text)), C.CString(text), C.ulong(len(text)))
-	C.EncodeUnicode((*C.uchar)(unsafe.Pointer(&sms.Number)), C.CString(number), C.ulong(len(number)))
+	smsc, err := g.getSMSC(opts.SMSC)
+	if err != nil {
+		return nil, err
+	}
+
+	setOptions(&sms, opts, &smsc)
+	return g.sendParts(ctx, number, &sms)
+}
+
+// Sends 8-bit data message, ports are set in UDH unless both are negative
+func (g *GSM) SendBinarySMS(number string, data []byte, srcPort, dstPort int) error {
+	_, err := g.SendBinarySMSContext(context.Background(), number, data, srcPort, dstPort)
+	return err
+}
+
+// Sends 8-bit data message, waiting for the network reply until ctx is done.
+//
+// Data longer than fits one message with the port header fails with ErrInvalidData.
+func (g *GSM) SendBinarySMSContext(ctx context.Context, number string, data []byte, srcPort, dstPort int) (result *SendResult, err error) {
+	udh := portsUDH(srcPort, dstPort)
+	if limit := C.GSM_MAX_8BIT_SMS_LENGTH - len(udh); len(data) > limit {
+		msg := fmt.Sprintf("binary message too long: %d bytes, at most %d", len(data), limit)
+		return nil, &Error{Code: CodeInvalidData, Op: "send sms", Msg: msg}
+	}
+
+	err = g.doContext(ctx, "send sms", func() (e error) {
+		var sms C.GSM_SMSMessage
+
+		sms.Coding = C.SMS_Coding_8bit
+
+		sms.UDH.Type = C.UDH_NoUDH
+		if len(udh) > 0 {
+			sms.UDH.Type = C.UDH_UserUDH
+			sms.UDH.Length = C.int(len(udh))
+			C.memcpy(unsafe.Pointer(&sms.UDH.Text[0]), unsafe.Pointer(&udh[0]), C.size_t(len(udh)))
+		}
+
+		sms.Length = C.int(len(data))
+		if len(data) > 0 {
+			C.memcpy(unsafe.Pointer(&sms.Text[0]), unsafe.Pointer(&data[0]), C.size_t(len(data)))
+		}
+
+		encodeUnicode(sms.Number[:], number)
+
+		smsc, e := g.getSMSC("")
+		if e != nil {
+			return
+		}
+
+		opts := DefaultSendOptions()
+		opts.Class = ClassNone // no class for data messages
+		setOptions(&sms, opts, &smsc)
+		result, e = g.sendParts(ctx, number, &sms)
+		return
+	})
+	return
+}
+
+// Returns SMSC with the given number, or the first SMSC stored in phone if empty
+func (g *GSM) getSMSC(number string) (smsc C.GSM_SMSC, err error) {
+	if number != "" {
+		encodeUnicode(smsc.Number[:], number)
+		return
+	}
 
 	// we need to know SMSC number
 	smsc.Location = 1
 	e := C.GSM_GetSMSC(g.sm, &smsc)
 	if e != ERR_NONE {
-		err = errors.New(errorString(int(e)))
-		return
+		err = newError("get smsc", e)
 	}
+	return
+}
+
+// Sets PDU type, class, validity and SMSC number in message
+func setOptions(sms *C.GSM_SMSMessage, opts SendOptions, smsc *C.GSM_SMSC) {
+	sms.PDU = C.SMS_Submit
+	if opts.DeliveryReport {
+		sms.PDU = C.SMS_Status_Report // submit message, request status report
+	}
+	sms.Class = C.schar(opts.class())
 
 	// set SMSC number in message
 	sms.SMSC.Number = smsc.Number
 
+	sms.SMSC.Validity.Format = C.SMS_Validity_NotAvailable
+	if opts.Validity > 0 {
+		sms.SMSC.Validity.Format = C.SMS_Validity_RelativeFormat
+		sms.SMSC.Validity.Relative = C.GSM_ValidityPeriod(pdu.Validity(opts.Validity))
+	}
+}
+
+// Sends message parts in order and remembers their references for delivery reports
+func (g *GSM) sendParts(ctx context.Context, number string, parts ...*C.GSM_SMSMessage) (*SendResult, error) {
+	result := &SendResult{Number: number, Sent: time.Now()}
+	for _, sms := range parts {
+		ref, err := g.send(ctx, sms)
+		if err != nil {
+			return result, err
+		}
+		result.References = append(result.References, ref)
+		g.deliveries.add(result)
+	}
+	return result, nil
+}
+
+// Sends message and waits for network reply, returns message reference
+func (g *GSM) send(ctx context.Context, sms *C.GSM_SMSMessage) (int, error) {
 	// Set flag before callind SendSMS, some phones might give instant response
-	smsSendStatus = ERR_TIMEOUT
+	g.smsSendStatus = ERR_TIMEOUT
+	g.smsSendReference = -1
 
 	// send message
-	e = C.GSM_SendSMS(g.sm, &sms)
+	e := C.GSM_SendSMS(g.sm, sms)
 	if e != ERR_NONE {
-		err = errors.New(errorString(int(e)))
-		return
+		return -1, newError("send sms", e)
 	}
 
 	// wait for network reply
+	err := g.waitSendStatus(ctx)
+	return g.smsSendReference, err
+}
+
+// Reads the device until the send callback reports a status or ctx is done
+func (g *GSM) waitSendStatus(ctx context.Context) error {
 	for {
+		if err := contextError(ctx, "send sms"); err != nil {
+			return err
+		}
 		C.GSM_ReadDevice(g.sm, C.gboolean(1))
-		if smsSendStatus == ERR_NONE {
-			break
+		if g.smsSendStatus == ERR_NONE {
+			return nil
 		}
-		if smsSendStatus != ERR_TIMEOUT {
-			err = errors.New(errorString(int(smsSendStatus)))
-			break
+		if g.smsSendStatus != ERR_TIMEOUT {
+			return newError("send sms", g.smsSendStatus)
 		}
 	}
-
-	return
 }
 
+// Blocks until a message is received, the worker must be polling (see WaitForSMS)
 func (g *GSM) AlwaysReadUntilBreak() {
-	smsReceivedStatus = ERR_TIMEOUT
-	for {
-		C.GSM_ReadDevice(g.sm, C.gboolean(1))
-		if smsReceivedStatus == ERR_NONE {
-			break
-		}
+	select {
+	case <-g.received:
+	case <-g.done:
 	}
 }
 
-func (g *GSM) SendLongSMS(text, number string) (err error) {
+// Sends multipart message, options default to DefaultSendOptions
+func (g *GSM) SendLongSMS(text, number string, opts ...SendOptions) error {
+	_, err := g.SendLongSMSContext(context.Background(), text, number, opts...)
+	return err
+}
+
+// Sends multipart message, waiting for the network reply to each part until ctx is done
+func (g *GSM) SendLongSMSContext(ctx context.Context, text, number string, opts ...SendOptions) (result *SendResult, err error) {
+	err = g.doContext(ctx, "send sms", func() (e error) {
+		result, e = g.sendLongSMS(ctx, text, number, sendOptions(opts))
+		return
+	})
+	return
+}
+
+func (g *GSM) sendLongSMS(ctx context.Context, text, number string, opts SendOptions) (result *SendResult, err error) {
 	var sms C.GSM_MultiSMSMessage
 	var smsInfo C.GSM_MultiPartSMSInfo
-	var smsc C.GSM_SMSC
-	//var debugInfo *C.GSM_Debug_Info
-	temp := text + text + "aa" //buffer size is 2*(len(text) + 1)
-	bufferText := (*C.uchar)(unsafe.Pointer(C.CString(temp)))
+
+	// gammu copies the text into message parts, buffer is not needed after encoding
+	bufferText := unicodeBuffer(text)
+	defer C.free(unsafe.Pointer(bufferText))
 
 	C.GSM_ClearMultiPartSMSInfo(&smsInfo)
-	smsInfo.Class = 1
+	smsInfo.Class = C.int(opts.class())
 	smsInfo.EntriesNum = 1
 	smsInfo.UnicodeCoding = C.gboolean(0)
+	if opts.Unicode || !isGSM7(text) {
+		smsInfo.UnicodeCoding = C.gboolean(1)
+	}
 	smsInfo.Entries[0].ID = C.SMS_ConcatenatedTextLong
-	C.EncodeUnicode(bufferText, C.CString(text), C.ulong(len(text)))
 	smsInfo.Entries[0].Buffer = bufferText
 
 	e := C.GSM_EncodeMultiPartSMS(nil, &smsInfo, &sms)
 	if e != ERR_NONE {
-		err = errors.New(errorString(int(e)))
+		err = newError("encode sms", e)
+		return
 	}
 
-	/*
-		sms.PDU = C.SMS_Submit                           // submit message
-		sms.UDH.Type = C.UDH_NoUDH                       // no UDH, just a plain message
-		sms.Coding = C.SMS_Coding_Default_No_Compression // default coding for text
-		sms.Class = 1                                    // class 1 message (normal)
-
-		C.EncodeUnicode((*C.uchar)(unsafe.Pointer(&sms.Text)), C.CString(text), C.ulong(len(text)))
-		C.EncodeUnicode((*C.uchar)(unsafe.Pointer(&sms.Number)), C.CString(number), C.ulong(len(number)))
-	*/
-
-	// we need to know SMSC number
-	smsc.Location = 1
-	e = C.GSM_GetSMSC(g.sm, &smsc)
-	if e != ERR_NONE {
-		err = errors.New(errorString(int(e)))
+	smsc, err := g.getSMSC(opts.SMSC)
+	if err != nil {
 		return
 	}
 
-	for i := 0; i < int(sms.Number); i++ {
-		// set SMSC number in message
-		sms.SMS[i].SMSC.Number = smsc.Number
-
-		C.EncodeUnicode((*C.uchar)(unsafe.Pointer(&sms.SMS[i].Number)), C.CString(number), C.ulong(len(number)))
-		sms.SMS[i].PDU = C.SMS_Status_Report
-		// Set flag before callind SendSMS, some phones might give instant response
-		smsSendStatus = ERR_TIMEOUT
+	parts := make([]*C.GSM_SMSMessage, int(sms.Number))
+	for i := range parts {
+		encodeUnicode(sms.SMS[i].Number[:], number)
+		setOptions(&sms.SMS[i], opts, &smsc)
+		parts[i] = &sms.SMS[i]
+	}
 
-		// send message
-		e = C.GSM_SendSMS(g.sm, &sms.SMS[i])
-		if e != ERR_NONE {
-			err = errors.New(errorString(int(e)))
-			return
-		}
+	return g.sendParts(ctx, number, parts...)
+}
 
-		// wait for network reply
-		for {
-			C.GSM_ReadDevice(g.sm, C.gboolean(1))
-			if smsSendStatus == ERR_NONE {
-				break
-			}
-			if smsSendStatus != ERR_TIMEOUT {
-				err = errors.New(errorString(int(smsSendStatus)))
-				break
-			}
-		}
-	}
+func (g *GSM) ReadSMS(delete bool) ([]*Message, error) {
+	return g.ReadSMSContext(context.Background(), delete)
+}
 
+// Reads messages until all folders are read or ctx is done
+func (g *GSM) ReadSMSContext(ctx context.Context, delete bool) (messages []*Message, err error) {
+	err = g.doContext(ctx, "read sms", func() (e error) {
+		messages, e = g.readSMS(ctx, delete)
+		return
+	})
 	return
 }
 
-func (g *GSM) ReadSMS(delete bool) (messages []*SmsRead, err error) {
+func (g *GSM) readSMS(ctx context.Context, delete bool) (messages []*Message, err error) {
 	var sms C.GSM_MultiSMSMessage
+	var smsReadStatus C.GSM_Error
 
-	smsReadStatus = ERR_NONE
 	start := C.gboolean(1)
 	sms.Number = C.int(0)
 	sms.SMS[0].Location = C.int(0)
 	sms.SMS[0].Folder = C.int(0)
 
 	for {
+		err = contextError(ctx, "read sms")
+		if err != nil {
+			return
+		}
 		smsReadStatus = C.GSM_GetNextSMS(g.sm, &sms, start)
 		if smsReadStatus != ERR_NONE {
 			if smsReadStatus != ERR_EMPTY {
-				err = errors.New(errorString(int(smsReadStatus)))
+				err = newError("read sms", smsReadStatus)
 				return
 			}
 			break
 		}
 		start = C.gboolean(0)
 		for i := 0; i < int(sms.Number); i++ {
-			if sms.SMS[i].Coding == C.SMS_Coding_8bit {
-				log.Println("8-bit message, can not display")
-			} else {
-				number := C.GoString(C.DecodeUnicodeConsole((*C.uchar)(unsafe.Pointer(&sms.SMS[i].Number))))
-				t := C.GoString(C.DecodeUnicodeConsole((*C.uchar)(unsafe.Pointer(&sms.SMS[i].Text))))
-				messages = append(messages, &SmsRead{int(sms.SMS[i].Location), int(sms.SMS[i].Folder), number, t})
-				if delete {
-					e := C.GSM_DeleteSMS(g.sm, &sms.SMS[i])
-					if e != ERR_NONE {
-						err = errors.New(errorString(int(e)))
-						return
-					}
+			messages = append(messages, newMessage(&sms.SMS[i]))
+			if delete {
+				e := C.GSM_DeleteSMS(g.sm, &sms.SMS[i])
+				if e != ERR_NONE {
+					err = newError("delete sms", e)
+					return
 				}
 			}
 		}
@@ -296,24 +605,52 @@ func (g *GSM) ReadSMS(delete bool) (messages []*SmsRead, err error) {
 	return
 }
 
-// Terminates connection and free memory
+// Deletes message from phone memory by its location and folder
+func (g *GSM) DeleteSMSContext(ctx context.Context, msg *Message) error {
+	return g.doContext(ctx, "delete sms", func() error {
+		var sms C.GSM_SMSMessage
+		sms.Location = C.int(msg.Location)
+		sms.Folder = C.int(msg.Folder)
+
+		return newError("delete sms", C.GSM_DeleteSMS(g.sm, &sms))
+	})
+}
+
+// Terminates connection, free memory and stops the worker
 func (g *GSM) Terminate() (err error) {
+	err = errTerminated
+	g.once.Do(func() {
+		err = g.do(g.terminate)
+		close(g.done)
+		g.queue(nil)
+	})
+	return
+}
+
+func (g *GSM) terminate() (err error) {
 	// terminate connection
 	e := C.GSM_TerminateConnection(g.sm)
 	if e != ERR_NONE {
-		err = errors.New(errorString(int(e)))
+		err = newError("terminate", e)
 	}
 
 	// free up used memory
 	C.GSM_FreeStateMachine(g.sm)
-	if g.modem != nil {
-		g.modem.close()
-	}
+	g.sm = nil
+	g.handle.Delete()
 	return
 }
 
 // Checks if phone is connected
-func (g *GSM) IsConnected() bool {
+func (g *GSM) IsConnected() (connected bool) {
+	g.do(func() error {
+		connected = g.isConnected()
+		return nil
+	})
+	return
+}
+
+func (g *GSM) isConnected() bool {
 	if g.sm == nil {
 		return false
 	}
@@ -321,94 +658,396 @@ func (g *GSM) IsConnected() bool {
 	return int(C.GSM_IsConnected(g.sm)) != 0
 }
 
-func (g *GSM) WaitForSMS(wait int) error {
-	e := C.GSM_SetIncomingSMS(g.sm, C.gboolean(wait))
-	if e != ERR_NONE {
-		return errors.New(errorString(int(e)))
+// Returns device and SIM identification, fields the phone does not
+// provide are left empty. ICCID stays empty, libGammu neither reads it nor
+// passes AT commands through; ATBackend.Info reads it with AT+CCID.
+func (g *GSM) Info() (info *DeviceInfo, err error) {
+	err = g.do(func() (e error) {
+		info, e = g.info()
+		return
+	})
+	return
+}
+
+func (g *GSM) info() (*DeviceInfo, error) {
+	var value [256]C.char
+	var date [256]C.char
+	var num C.double
+
+	info := &DeviceInfo{}
+	get := func(op string, e C.GSM_Error, dst *string) error {
+		err := newError(op, e)
+		if err == nil {
+			*dst = C.GoString(&value[0])
+		}
+		value[0] = 0
+		if optional(err) {
+			return nil
+		}
+		return err
+	}
+
+	if err := get("manufacturer", C.GSM_GetManufacturer(g.sm, &value[0]), &info.Manufacturer); err != nil {
+		return info, err
+	}
+	if err := get("model", C.GSM_GetModel(g.sm, &value[0]), &info.Model); err != nil {
+		return info, err
+	}
+	if err := get("firmware", C.GSM_GetFirmware(g.sm, &value[0], &date[0], &num), &info.Firmware); err != nil {
+		return info, err
+	}
+	if err := get("imei", C.GSM_GetIMEI(g.sm, &value[0]), &info.IMEI); err != nil {
+		return info, err
+	}
+	if err := get("imsi", C.GSM_GetSIMIMSI(g.sm, &value[0]), &info.IMSI); err != nil {
+		return info, err
 	}
-	return nil
+
+	return info, nil
+}
+
+// Returns signal quality, battery charge and network registration,
+// fields the phone does not provide are left at their unknown values
+func (g *GSM) Status() (status *DeviceStatus, err error) {
+	err = g.do(func() (e error) {
+		status, e = g.status()
+		return
+	})
+	return
+}
+
+func (g *GSM) status() (*DeviceStatus, error) {
+	var signal C.GSM_SignalQuality
+	var battery C.GSM_BatteryCharge
+	var network C.GSM_NetworkInfo
+
+	status := &DeviceStatus{SignalPercent: -1, BitErrorRate: -1, BatteryPercent: -1}
+
+	err := newError("signal quality", C.GSM_GetSignalQuality(g.sm, &signal))
+	if err == nil {
+		if signal.SignalStrength != -1 {
+			status.SignalStrength = int(signal.SignalStrength)
+		}
+		status.SignalPercent = int(signal.SignalPercent)
+		status.BitErrorRate = int(signal.BitErrorRate)
+	} else if !optional(err) {
+		return status, err
+	}
+
+	err = newError("battery charge", C.GSM_GetBatteryCharge(g.sm, &battery))
+	if err == nil {
+		status.BatteryPercent = int(battery.BatteryPercent)
+		status.Charging = battery.ChargeState == C.GSM_BatteryCharging
+	} else if !optional(err) {
+		return status, err
+	}
+
+	err = newError("network info", C.GSM_GetNetworkInfo(g.sm, &network))
+	if err == nil {
+		status.Network = networkState(network.State)
+		status.OperatorCode = C.GoString(&network.NetworkCode[0])
+		status.OperatorName = decodeUnicode(network.NetworkName[:])
+		if status.OperatorName == "" && status.OperatorCode != "" {
+			status.OperatorName = networkName(status.OperatorCode)
+		}
+		status.LAC = C.GoString(&network.LAC[0])
+		status.CellID = C.GoString(&network.CID[0])
+	} else if !optional(err) {
+		return status, err
+	}
+
+	return status, nil
+}
+
+// Converts gammu network state
+func networkState(s C.GSM_NetworkInfo_State) NetworkState {
+	switch s {
+	case C.GSM_HomeNetwork:
+		return NetworkHome
+	case C.GSM_RoamingNetwork:
+		return NetworkRoaming
+	case C.GSM_RequestingNetwork:
+		return NetworkSearching
+	case C.GSM_NoNetwork:
+		return NetworkNone
+	case C.GSM_RegistrationDenied:
+		return NetworkDenied
+	}
+	return NetworkUnknown
+}
+
+// Returns operator name for network code from the gammu database
+func networkName(code string) string {
+	cs := C.CString(code)
+	defer C.free(unsafe.Pointer(cs))
+
+	name := C.GSM_GetNetworkName(cs)
+	if name == nil {
+		return ""
+	}
+	return decodeUnicode(unsafe.Slice((*C.uchar)(unsafe.Pointer(name)), 2*(C.UnicodeLength(name)+1)))
+}
+
+// Enables or disables incoming message notifications, while enabled the worker
+// polls the device for incoming messages
+func (g *GSM) WaitForSMS(wait int) error {
+	return g.do(func() error {
+		e := C.GSM_SetIncomingSMS(g.sm, C.gboolean(wait))
+		if e != ERR_NONE {
+			return newError("incoming sms", e)
+		}
+		g.incoming = wait != 0
+		return nil
+	})
 }
 
 // Callback for message sending
 //export sendSMSCallback
 func sendSMSCallback(sm *C.GSM_StateMachine, status C.int, messageReference C.int, user_data unsafe.Pointer) {
+	g := cgo.Handle(user_data).Value().(*GSM)
 	t := fmt.Sprintf("Sent SMS on device %s - ", C.GoString(C.GSM_GetConfig(sm, -1).Device))
+	g.smsSendReference = int(messageReference)
 	if int(status) == 0 {
-		log.Printf(t + "OK\n")
-		smsSendStatus = ERR_NONE
+		log.Printf("%sOK\n", t)
+		g.smsSendStatus = ERR_NONE
 	} else {
 		log.Printf(t+"ERROR %d\n", int(status))
-		smsSendStatus = ERR_UNKNOWN
+		g.smsSendStatus = ERR_UNKNOWN
 	}
 }
 
+// Callback for incoming USSD
+//export getUSSDCallback
+func getUSSDCallback(sm *C.GSM_StateMachine, ussd *C.GSM_USSDMessage, user_data unsafe.Pointer) {
+	g := cgo.Handle(user_data).Value().(*GSM)
+	if !g.ussdWaiting {
+		return
+	}
+
+	g.ussdResponse = &USSDResponse{
+		Status: ussdStatus(ussd.Status),
+		Text:   decodeUnicode(ussd.Text[:]),
+		DCS:    -1,
+	}
+}
+
+// Converts gammu USSD status
+func ussdStatus(s C.GSM_USSDStatus) USSDStatus {
+	switch s {
+	case C.USSD_NoActionNeeded:
+		return USSDNoActionNeeded
+	case C.USSD_ActionNeeded:
+		return USSDActionNeeded
+	case C.USSD_Terminated:
+		return USSDTerminated
+	case C.USSD_AnotherClient:
+		return USSDAnotherClient
+	case C.USSD_NotSupported:
+		return USSDNotSupported
+	case C.USSD_Timeout:
+		return USSDTimeout
+	}
+	return USSDUnknown
+}
+
 // Callback for message sending
 //export getSMSCallback
 func getSMSCallback(sm *C.GSM_StateMachine, sms *C.GSM_SMSMessage, user_data unsafe.Pointer) {
-	number := C.GoString(C.DecodeUnicodeConsole((*C.uchar)(unsafe.Pointer(&sms.Number))))
-	text := C.GoString(C.DecodeUnicodeConsole((*C.uchar)(unsafe.Pointer(&sms.Text))))
-	err := callBack(number, text)
-	if err != nil {
-		log.Printf("error : %s", err.Error())
+	g := cgo.Handle(user_data).Value().(*GSM)
+	msg := newMessage(sms)
+
+	// status reports are not passed to message callbacks
+	if msg.PDU == PDUStatusReport {
+		report := newDeliveryReport(msg)
+		g.deliveries.match(report)
+		if handler := g.deliveryHandler; handler != nil {
+			g.queue(func() {
+				err := handler(report)
+				if err != nil {
+					log.Printf("error : %s", err.Error())
+				}
+			})
+		}
+		return
 	}
-	smsReceivedStatus = ERR_NONE
+
+	callBack, messageHandler := g.callBack, g.messageHandler
+	g.queue(func() {
+		if callBack != nil {
+			err := callBack(msg.Number, msg.Text)
+			if err != nil {
+				log.Printf("error : %s", err.Error())
+			}
+		}
+		if messageHandler != nil {
+			err := messageHandler(msg)
+			if err != nil {
+				log.Printf("error : %s", err.Error())
+			}
+		}
+		select {
+		case g.received <- struct{}{}:
+		default:
+		}
+	})
+}
+
+// Sends USSD code and returns the reply text, device is ignored and kept
+// for compatibility, the code is sent on the gammu connection
+func (g *GSM) GetUSSDByCode(code string, device string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	resp, err := g.USSDContext(ctx, code)
 	if err != nil {
-		log.Printf("error : %s", err.Error())
+		return "", err
 	}
+	return resp.Text, nil
 }
 
-func (g *GSM) GetUSSDByCode(code string, device string) (string, error) {
-	deviceName := device
-	if device == "" && g.sm != nil {
-		deviceName = C.GoString(C.GSM_GetConfig(g.sm, -1).Device)
-	}
-	isConnectedBefore := false
-	if g.IsConnected() {
-		isConnectedBefore = true
-		e := C.GSM_TerminateConnection(g.sm)
-		if e != ERR_NONE {
-			return "", errors.New(errorString(int(e)))
-		}
+// Sends USSD code and waits for the network reply until ctx is done
+func (g *GSM) USSDContext(ctx context.Context, code string) (resp *USSDResponse, err error) {
+	err = g.doContext(ctx, "ussd", func() (e error) {
+		resp, e = g.ussd(ctx, code)
+		return
+	})
+	return
+}
+
+func (g *GSM) ussd(ctx context.Context, code string) (*USSDResponse, error) {
+	e := C.GSM_SetIncomingUSSD(g.sm, C.gboolean(1))
+	if e != ERR_NONE {
+		return nil, newError("ussd", e)
 	}
-	if !g.IsConnected() && isConnectedBefore {
-		defer func() {
-			err := g.Connect()
-			if err != nil {
-				log.Printf("Error: %v\n", err)
-			}
-		}()
+
+	g.ussdWaiting = true
+	g.ussdResponse = nil
+	defer func() {
+		g.ussdWaiting = false
+	}()
+
+	number := C.CString(code)
+	defer C.free(unsafe.Pointer(number))
+
+	e = C.GSM_DialService(g.sm, number)
+	if e != ERR_NONE {
+		return nil, newError("ussd", e)
 	}
-	if g.modem == nil {
-		m, err := NewModem(deviceName)
-		if err != nil {
-			log.Printf("error open ussd port : %s", err.Error())
+
+	// reply comes with the incoming USSD callback
+	for g.ussdResponse == nil {
+		if err := contextError(ctx, "ussd"); err != nil {
+			return nil, err
 		}
-		g.modem = m
+		C.GSM_ReadDevice(g.sm, C.gboolean(1))
 	}
-	if g.modem != nil {
-		_, err := g.modem.SendCommand("AT+CSCS=\"GSM\"\r\n", true)
-		if err != nil {
-			log.Printf("error : %s", err.Error())
-			return "", err
-		}
-		_, err = g.modem.SendCommand(fmt.Sprintf("AT+CUSD=1,\"%s\",15\r\n", code), true)
-		if err != nil {
-			log.Printf("error : %s", err.Error())
-			return "", err
+
+	return g.ussdResponse, g.ussdResponse.err()
+}
+
+func (g *GSM) SetCallBack(fx func(string, string) error) {
+	g.do(func() error {
+		g.callBack = fx
+		return nil
+	})
+}
+
+// Sets handler called with every incoming message, alongside the SetCallBack callback
+func (g *GSM) SetMessageHandler(fx func(*Message) error) {
+	g.do(func() error {
+		g.messageHandler = fx
+		return nil
+	})
+}
+
+// Sets handler called with status reports, matched to messages sent by this GSM
+func (g *GSM) SetDeliveryReportHandler(fx func(*DeliveryReport) error) {
+	g.do(func() error {
+		g.deliveryHandler = fx
+		return nil
+	})
+}
+
+// Converts gammu message
+func newMessage(sms *C.GSM_SMSMessage) *Message {
+	msg := &Message{
+		Location:         int(sms.Location),
+		Folder:           int(sms.Folder),
+		Number:           decodeUnicode(sms.Number[:]),
+		Text:             decodeUnicode(sms.Text[:]),
+		SMSC:             decodeUnicode(sms.SMSC.Number[:]),
+		SMSCTime:         dateTime(&sms.SMSCTime),
+		DateTime:         dateTime(&sms.DateTime),
+		State:            State(sms.State),
+		Coding:           Coding(sms.Coding),
+		Class:            int(sms.Class),
+		PDU:              PDUType(sms.PDU),
+		MessageReference: int(sms.MessageReference),
+		DeliveryStatus:   int(sms.DeliveryStatus),
+		SrcPort:          -1,
+		DstPort:          -1,
+	}
+
+	if sms.Coding == C.SMS_Coding_8bit {
+		msg.Text = ""
+		msg.Data = C.GoBytes(unsafe.Pointer(&sms.Text[0]), sms.Length)
+	}
+
+	msg.UDH.ID = -1
+	if sms.UDH.Type != C.UDH_NoUDH {
+		msg.UDH.ID = int(sms.UDH.ID8bit)
+		if sms.UDH.ID16bit != -1 {
+			msg.UDH.ID = int(sms.UDH.ID16bit)
 		}
+		msg.UDH.Part = int(sms.UDH.PartNumber)
+		msg.UDH.Parts = int(sms.UDH.AllParts)
+		msg.UDH.Data = C.GoBytes(unsafe.Pointer(&sms.UDH.Text[0]), sms.UDH.Length)
+		msg.SrcPort, msg.DstPort = udhPorts(msg.UDH.Data)
+	}
 
-		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-		defer cancel()
+	return msg
+}
 
-		output, err := g.modem.ReadWithTimeout(ctx)
-		if err != nil {
-			return "", err
+// Decodes gammu unicode string, which is zero terminated UTF-16 big endian
+func decodeUnicode(src []C.uchar) string {
+	var units []uint16
+	for i := 0; i+1 < len(src); i += 2 {
+		u := uint16(src[i])<<8 | uint16(src[i+1])
+		if u == 0 {
+			break
 		}
-		return output, nil
+		units = append(units, u)
 	}
-	return "", nil
+	return string(utf16.Decode(units))
 }
 
-func (g *GSM) SetCallBack(fx func(string, string) error) {
-	callBack = fx
+// Encodes string to gammu unicode in dst, truncated to fit with the terminator
+func encodeUnicode(dst []C.uchar, s string) {
+	units := utf16.Encode([]rune(s))
+	if max := len(dst)/2 - 1; len(units) > max {
+		units = units[:max]
+	}
+	for i, u := range units {
+		dst[2*i] = C.uchar(u >> 8)
+		dst[2*i+1] = C.uchar(u)
+	}
+	dst[2*len(units)] = 0
+	dst[2*len(units)+1] = 0
+}
+
+// Returns s as gammu unicode string in C memory, caller must free it
+func unicodeBuffer(s string) *C.uchar {
+	size := (len(utf16.Encode([]rune(s))) + 1) * 2
+	buf := (*C.uchar)(C.malloc(C.size_t(size)))
+	encodeUnicode(unsafe.Slice(buf, size), s)
+	return buf
+}
+
+// Converts gammu date, zero time if not set
+func dateTime(dt *C.GSM_DateTime) time.Time {
+	if dt.Year == 0 {
+		return time.Time{}
+	}
+	loc := time.FixedZone("", int(dt.Timezone))
+	return time.Date(int(dt.Year), time.Month(dt.Month), int(dt.Day), int(dt.Hour), int(dt.Minute), int(dt.Second), 0, loc)
 }
@@ -0,0 +1,354 @@
+// Package gsm7 encodes and decodes text in the GSM 7-bit default alphabet
+// (3GPP TS 23.038), its extension table and the national language shift tables.
+//
+// Shift tables are implemented for Turkish, Spanish and Portuguese. The
+// Indian languages and Urdu of annex A are not, tables selecting them fail
+// to encode and decode with *UnsupportedError.
+package gsm7
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// National language identifier, as used in the shift table information elements
+type Language byte
+
+const (
+	Default    Language = 0
+	Turkish    Language = 1
+	Spanish    Language = 2 // single shift table only
+	Portuguese Language = 3
+
+	// tables not implemented
+	Bengali   Language = 4
+	Gujarati  Language = 5
+	Hindi     Language = 6
+	Kannada   Language = 7
+	Malayalam Language = 8
+	Oriya     Language = 9
+	Punjabi   Language = 10
+	Tamil     Language = 11
+	Telugu    Language = 12
+	Urdu      Language = 13
+)
+
+var languageNames = map[Language]string{
+	Default: "default", Turkish: "turkish", Spanish: "spanish", Portuguese: "portuguese",
+	Bengali: "bengali", Gujarati: "gujarati", Hindi: "hindi", Kannada: "kannada",
+	Malayalam: "malayalam", Oriya: "oriya", Punjabi: "punjabi", Tamil: "tamil",
+	Telugu: "telugu", Urdu: "urdu",
+}
+
+// Returns language name, marked unsupported if this package has no tables for it
+func (l Language) String() string {
+	if !l.Supported() {
+		return l.name() + " (unsupported)"
+	}
+	return l.name()
+}
+
+func (l Language) name() string {
+	if name, ok := languageNames[l]; ok {
+		return name
+	}
+	return fmt.Sprintf("language %d", byte(l))
+}
+
+// Reports whether this package has a shift table for the language
+func (l Language) Supported() bool {
+	_, ok := singleTables[l]
+	return ok
+}
+
+// Escape to the single shift table
+const Escape = 0x1B
+
+// Tables used to encode or decode text.
+//
+// The zero value is the default alphabet with its extension table. Supported
+// languages without a table of the kind, like Spanish without a locking shift
+// table, fall back to the default one.
+type Tables struct {
+	Locking Language // replaces the default alphabet
+	Single  Language // replaces the extension table
+}
+
+// Error returned for tables of a language without an implemented table
+type UnsupportedError struct {
+	Language Language
+}
+
+func (e *UnsupportedError) Error() string {
+	return "gsm7: no shift tables for " + e.Language.name()
+}
+
+// Returns *UnsupportedError if a language of the tables is not supported
+func (t Tables) Check() error {
+	for _, l := range []Language{t.Locking, t.Single} {
+		if !l.Supported() {
+			return &UnsupportedError{l}
+		}
+	}
+	return nil
+}
+
+// Septets taken by a header holding only the shift elements of the tables,
+// 0 for the default tables
+func (t Tables) headerSeptets() int {
+	octets := 0
+	for _, l := range []Language{t.Locking, t.Single} {
+		if l != Default {
+			octets += 3
+		}
+	}
+	if octets == 0 {
+		return 0
+	}
+	// header length octet, septets start after fill bits
+	return ((1+octets)*8 + 6) / 7
+}
+
+// Returns tables for language, locking shift only if the language has one.
+// Returns the default tables and false if the language is not supported.
+func LanguageTables(l Language) (Tables, bool) {
+	if !l.Supported() {
+		return Tables{}, false
+	}
+	t := Tables{Single: l}
+	if _, ok := lockingTables[l]; ok {
+		t.Locking = l
+	}
+	return t, true
+}
+
+// Septets of each rune, one for the locking table and two for the single table
+type encoding map[rune][]byte
+
+var (
+	encodingsLock sync.Mutex
+	encodings     = make(map[Tables]encoding)
+)
+
+// Returns encoding of tables, built on first use, empty for unsupported tables
+func (t Tables) encoding() encoding {
+	encodingsLock.Lock()
+	defer encodingsLock.Unlock()
+
+	if e, ok := encodings[t]; ok {
+		return e
+	}
+
+	e := make(encoding)
+	if t.Check() != nil {
+		encodings[t] = e
+		return e
+	}
+	for s, r := range t.locking() {
+		if s != Escape {
+			e[r] = []byte{byte(s)}
+		}
+	}
+	for s, r := range t.single() {
+		if _, ok := e[r]; !ok {
+			e[r] = []byte{Escape, s}
+		}
+	}
+	encodings[t] = e
+	return e
+}
+
+func (t Tables) locking() []rune {
+	if l, ok := lockingTables[t.Locking]; ok {
+		return l
+	}
+	return lockingTables[Default]
+}
+
+func (t Tables) single() map[byte]rune {
+	if s, ok := singleTables[t.Single]; ok {
+		return s
+	}
+	return singleTables[Default]
+}
+
+// Error returned when text has runes missing from the tables
+type UnencodableError struct {
+	Runes []rune
+}
+
+func (e *UnencodableError) Error() string {
+	q := make([]string, len(e.Runes))
+	for i, r := range e.Runes {
+		q[i] = fmt.Sprintf("%q", r)
+	}
+	return "gsm7: not in alphabet: " + strings.Join(q, ", ")
+}
+
+// Returns septets of text, *UnencodableError if a rune is missing from the tables,
+// *UnsupportedError for tables of an unsupported language
+func (t Tables) Encode(text string) ([]byte, error) {
+	if err := t.Check(); err != nil {
+		return nil, err
+	}
+	e := t.encoding()
+	septets := make([]byte, 0, len(text))
+	for _, r := range text {
+		s, ok := e[r]
+		if !ok {
+			return nil, &UnencodableError{t.Unencodable(text)}
+		}
+		septets = append(septets, s...)
+	}
+	return septets, nil
+}
+
+// Decodes septets, *UnsupportedError for tables of an unsupported language.
+// Unknown single shift septets and a trailing escape are shown as space, as
+// 3GPP TS 23.038 requires.
+func (t Tables) Decode(septets []byte) (string, error) {
+	if err := t.Check(); err != nil {
+		return "", err
+	}
+
+	locking, single := t.locking(), t.single()
+	runes := make([]rune, 0, len(septets))
+	for i := 0; i < len(septets); i++ {
+		s := septets[i] & 0x7F
+		if s != Escape {
+			runes = append(runes, locking[s])
+			continue
+		}
+		i++
+		if i == len(septets) {
+			runes = append(runes, ' ')
+		} else if r, ok := single[septets[i]&0x7F]; ok {
+			runes = append(runes, r)
+		} else {
+			runes = append(runes, ' ')
+		}
+	}
+	return string(runes), nil
+}
+
+// Returns number of septets for r, 0 if it is missing from the tables or they are unsupported
+func (t Tables) Septets(r rune) int {
+	return len(t.encoding()[r])
+}
+
+// Returns number of septets for text, false if a rune is missing from the tables or they are unsupported
+func (t Tables) Count(text string) (int, bool) {
+	e := t.encoding()
+	n := 0
+	for _, r := range text {
+		s, ok := e[r]
+		if !ok {
+			return 0, false
+		}
+		n += len(s)
+	}
+	return n, true
+}
+
+// Returns runes of text missing from the tables, each once in order of appearance.
+// Text with any such rune has to be sent as UCS-2.
+func (t Tables) Unencodable(text string) []rune {
+	e := t.encoding()
+	var runes []rune
+	seen := make(map[rune]bool)
+	for _, r := range text {
+		if _, ok := e[r]; !ok && !seen[r] {
+			seen[r] = true
+			runes = append(runes, r)
+		}
+	}
+	return runes
+}
+
+// Encodes text with the default tables
+func Encode(text string) ([]byte, error) {
+	return Tables{}.Encode(text)
+}
+
+// Decodes septets with the default tables
+func Decode(septets []byte) string {
+	text, _ := Tables{}.Decode(septets)
+	return text
+}
+
+// Returns runes of text missing from the default tables
+func Unencodable(text string) []rune {
+	return Tables{}.Unencodable(text)
+}
+
+// Returns true if text can be encoded with the default tables
+func Valid(text string) bool {
+	_, ok := Tables{}.Count(text)
+	return ok
+}
+
+// Returns tables encoding text in the fewest septets, trying default tables first
+// and then the tables of each supported language. Returns false if none can
+// encode text.
+//
+// The septets count the user data header the shift elements need, 5 for one
+// element and 8 for both when they are the only header elements. Callers
+// sizing messages have to add the header too, the text alone may fit a
+// single message while text and header do not.
+func Select(text string, languages ...Language) (Tables, bool) {
+	best, min := Tables{}, -1
+	if n, ok := best.Count(text); ok {
+		min = n
+	}
+
+	for _, l := range languages {
+		lt, ok := LanguageTables(l)
+		if !ok {
+			continue
+		}
+		for _, t := range []Tables{{Single: l}, lt} {
+			if n, ok := t.Count(text); ok && (min < 0 || n+t.headerSeptets() < min) {
+				best, min = t, n+t.headerSeptets()
+			}
+		}
+	}
+	return best, min >= 0
+}
+
+// Packs septets into octets starting after fill bits
+func Pack(septets []byte, fill int) []byte {
+	out := make([]byte, (fill+7*len(septets)+7)/8)
+	for i, s := range septets {
+		s &= 0x7F
+		pos := fill + 7*i
+		out[pos/8] |= s << uint(pos%8)
+		if pos%8 > 1 {
+			out[pos/8+1] |= s >> uint(8-pos%8)
+		}
+	}
+	return out
+}
+
+// Unpacks n septets from octets starting after fill bits, fewer if data ends
+func Unpack(data []byte, fill, n int) []byte {
+	if n < 0 {
+		n = 0
+	}
+	if max := len(data) * 8 / 7; n > max {
+		n = max
+	}
+	septets := make([]byte, 0, n)
+	for i := 0; i < n; i++ {
+		pos := fill + 7*i
+		if pos/8 >= len(data) {
+			break
+		}
+		v := uint16(data[pos/8])
+		if pos/8+1 < len(data) {
+			v |= uint16(data[pos/8+1]) << 8
+		}
+		septets = append(septets, byte(v>>uint(pos%8))&0x7F)
+	}
+	return septets
+}
@@ -0,0 +1,241 @@
+package gsm7
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestPack(t *testing.T) {
+	tests := []struct {
+		text   string
+		fill   int
+		packed string
+	}{
+		{"hellohello", 0, "e8329bfd4697d9ec37"},
+		{"Test", 0, "d4f29c0e"},
+		{"", 0, ""},
+		{"A", 1, "82"},
+		{"hello", 6, "00bacc66bf01"},
+	}
+
+	for _, tt := range tests {
+		septets, err := Encode(tt.text)
+		if err != nil {
+			t.Fatal(err)
+		}
+		packed := Pack(septets, tt.fill)
+		if got := hex.EncodeToString(packed); got != tt.packed {
+			t.Errorf("Pack(%q, %d) = %s, want %s", tt.text, tt.fill, got, tt.packed)
+		}
+		if got := Decode(Unpack(packed, tt.fill, len(septets))); got != tt.text {
+			t.Errorf("Unpack(%s, %d) = %q, want %q", tt.packed, tt.fill, got, tt.text)
+		}
+	}
+}
+
+func TestPackRoundTrip(t *testing.T) {
+	septets := make([]byte, 128)
+	for i := range septets {
+		septets[i] = byte(i)
+	}
+	for fill := 0; fill < 7; fill++ {
+		for n := 0; n <= len(septets); n++ {
+			got := Unpack(Pack(septets[:n], fill), fill, n)
+			if !bytes.Equal(got, septets[:n]) {
+				t.Fatalf("fill %d, %d septets: got %v", fill, n, got)
+			}
+		}
+	}
+}
+
+func TestUnpackCount(t *testing.T) {
+	data := Pack([]byte("abcdefgh"), 0) // 7 octets
+
+	tests := []struct {
+		n, want int
+	}{
+		{-6, 0},
+		{0, 0},
+		{3, 3},
+		{8, 8},
+		{100, 8},
+	}
+	for _, tt := range tests {
+		if got := Unpack(data, 0, tt.n); len(got) != tt.want {
+			t.Errorf("Unpack(n=%d) returned %d septets, want %d", tt.n, len(got), tt.want)
+		}
+	}
+	if got := Unpack(nil, 3, 5); len(got) != 0 {
+		t.Errorf("Unpack(nil) = %v", got)
+	}
+}
+
+func TestEncode(t *testing.T) {
+	septets, err := Encode("a€[")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []byte{0x61, Escape, 0x65, Escape, 0x3C}; !bytes.Equal(septets, want) {
+		t.Errorf("Encode = %x, want %x", septets, want)
+	}
+
+	_, err = Encode("aжbжç")
+	var ue *UnencodableError
+	if !errors.As(err, &ue) {
+		t.Fatalf("err = %v, want *UnencodableError", err)
+	}
+	if string(ue.Runes) != "жç" {
+		t.Errorf("Runes = %q", string(ue.Runes))
+	}
+}
+
+func TestDecodeUnknownEscape(t *testing.T) {
+	if got := Decode([]byte{0x61, Escape, 0x01, 0x62}); got != "a b" {
+		t.Errorf("Decode = %q, want %q", got, "a b")
+	}
+	// escape at the end and escape to escape are shown as space too
+	if got := Decode([]byte{0x61, Escape}); got != "a " {
+		t.Errorf("Decode = %q, want %q", got, "a ")
+	}
+	if got := Decode([]byte{Escape, Escape, 0x61}); got != " a" {
+		t.Errorf("Decode = %q, want %q", got, " a")
+	}
+}
+
+func TestTables(t *testing.T) {
+	tests := []struct {
+		tables Tables
+		text   string
+	}{
+		{Tables{}, "@£$¥èéùìòÇ\nØø\rÅåΔ_ΦΓΛΩΠΨΣΘΞÆæßÉ !\"#¤%&'()*+,-./0123456789:;<=>?¡ABCDEFGHIJKLMNOPQRSTUVWXYZÄÖÑÜ§¿abcdefghijklmnopqrstuvwxyzäöñüà\f^{}\\[~]|€"},
+		{Tables{Locking: Turkish, Single: Turkish}, "ĞğİŞşçıI€Çö"},
+		{Tables{Single: Spanish}, "ÁÍÓÚáíóúç€ñ"},
+		{Tables{Locking: Portuguese, Single: Portuguese}, "êÔôÁáªÇÀ∞ÃÕÚÜ§~ãõ`â€Φ"},
+	}
+
+	for _, tt := range tests {
+		septets, err := tt.tables.Encode(tt.text)
+		if err != nil {
+			t.Errorf("%+v: %v", tt.tables, err)
+			continue
+		}
+		if got, err := tt.tables.Decode(septets); err != nil || got != tt.text {
+			t.Errorf("%+v: Decode = %q, %v, want %q", tt.tables, got, err, tt.text)
+		}
+		if n, ok := tt.tables.Count(tt.text); !ok || n != len(septets) {
+			t.Errorf("%+v: Count = %d, %v, want %d", tt.tables, n, ok, len(septets))
+		}
+	}
+}
+
+func TestTableSizes(t *testing.T) {
+	for l, table := range lockingTables {
+		if len(table) != 128 {
+			t.Errorf("%v locking table has %d septets", l, len(table))
+		}
+		if table[Escape] != Escape {
+			t.Errorf("%v locking table has no escape", l)
+		}
+	}
+	for l, table := range singleTables {
+		for s := range table {
+			if s >= 0x80 || s == Escape {
+				t.Errorf("%v single table has septet %#x", l, s)
+			}
+		}
+	}
+}
+
+func TestSelect(t *testing.T) {
+	tests := []struct {
+		text      string
+		languages []Language
+		tables    Tables
+		ok        bool
+	}{
+		{"plain", nil, Tables{}, true},
+		{"plain", []Language{Turkish}, Tables{}, true},
+		{"ş", nil, Tables{}, false},
+		// one shift element costs 5 septets of header, both cost 8
+		{"ş", []Language{Spanish, Turkish}, Tables{Single: Turkish}, true},
+		{"Ğ", []Language{Turkish}, Tables{Single: Turkish}, true},
+		{"ĞĞĞ", []Language{Turkish}, Tables{Single: Turkish}, true},
+		{"ĞĞĞĞ", []Language{Turkish}, Tables{Locking: Turkish, Single: Turkish}, true},
+		{"á", []Language{Spanish}, Tables{Single: Spanish}, true},
+		{"ж", []Language{Turkish, Spanish, Portuguese}, Tables{}, false},
+		{"ş", []Language{Hindi}, Tables{}, false},
+	}
+
+	for _, tt := range tests {
+		tables, ok := Select(tt.text, tt.languages...)
+		if ok != tt.ok || (ok && tables != tt.tables) {
+			t.Errorf("Select(%q, %v) = %+v, %v, want %+v, %v", tt.text, tt.languages, tables, ok, tt.tables, tt.ok)
+		}
+	}
+}
+
+func TestUnsupportedTables(t *testing.T) {
+	for _, tables := range []Tables{{Single: Hindi}, {Locking: Urdu}, {Locking: Bengali, Single: Bengali}, {Single: Language(42)}} {
+		var ue *UnsupportedError
+		if err := tables.Check(); !errors.As(err, &ue) {
+			t.Errorf("%+v: Check = %v", tables, err)
+		}
+		if _, err := tables.Encode("abc"); !errors.As(err, &ue) {
+			t.Errorf("%+v: Encode err = %v", tables, err)
+		}
+		if _, err := tables.Decode([]byte{0x61, 0x62}); !errors.As(err, &ue) {
+			t.Errorf("%+v: Decode err = %v", tables, err)
+		}
+		if n, ok := tables.Count("abc"); ok {
+			t.Errorf("%+v: Count = %d", tables, n)
+		}
+	}
+
+	_, err := Tables{Single: Hindi}.Decode(nil)
+	if want := "gsm7: no shift tables for hindi"; err == nil || err.Error() != want {
+		t.Errorf("err = %v, want %s", err, want)
+	}
+
+	// Spanish has no locking shift table, the default one is used
+	if err := (Tables{Locking: Spanish, Single: Spanish}).Check(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestLanguage(t *testing.T) {
+	if !Turkish.Supported() || !Default.Supported() || Urdu.Supported() {
+		t.Error("Supported reports wrong languages")
+	}
+	if s := Spanish.String(); s != "spanish" {
+		t.Errorf("Spanish.String() = %q", s)
+	}
+	if s := Hindi.String(); !strings.Contains(s, "unsupported") {
+		t.Errorf("Hindi.String() = %q", s)
+	}
+	if s := Language(42).String(); s != "language 42 (unsupported)" {
+		t.Errorf("Language(42).String() = %q", s)
+	}
+
+	if tables, ok := LanguageTables(Spanish); !ok || tables != (Tables{Single: Spanish}) {
+		t.Errorf("LanguageTables(Spanish) = %+v, %v", tables, ok)
+	}
+	if tables, ok := LanguageTables(Bengali); ok || tables != (Tables{}) {
+		t.Errorf("LanguageTables(Bengali) = %+v, %v", tables, ok)
+	}
+}
+
+func FuzzUnpack(f *testing.F) {
+	f.Add([]byte{0xE8, 0x32, 0x9B}, 0, 3)
+	f.Add([]byte{}, 6, -1)
+	f.Fuzz(func(t *testing.T, data []byte, fill, n int) {
+		if fill < 0 || fill > 6 {
+			return
+		}
+		if got := Unpack(data, fill, n); len(got) > len(data)*8/7 {
+			t.Errorf("Unpack returned %d septets from %d octets", len(got), len(data))
+		}
+	})
+}
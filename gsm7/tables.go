@@ -0,0 +1,43 @@
+package gsm7
+
+// Locking shift tables indexed by septet, 0x1B is the escape to the single shift table.
+// See 3GPP TS 23.038 6.2.1 and annex A.3.
+var lockingTables = map[Language][]rune{
+	Default: []rune("@£$¥èéùìòÇ\nØø\rÅåΔ_ΦΓΛΩΠΨΣΘΞ\x1bÆæßÉ !\"#¤%&'()*+,-./0123456789:;<=>?" +
+		"¡ABCDEFGHIJKLMNOPQRSTUVWXYZÄÖÑÜ§¿abcdefghijklmnopqrstuvwxyzäöñüà"),
+	Turkish: []rune("@£$¥€éùıòÇ\nĞğ\rÅåΔ_ΦΓΛΩΠΨΣΘΞ\x1bŞşßÉ !\"#¤%&'()*+,-./0123456789:;<=>?" +
+		"İABCDEFGHIJKLMNOPQRSTUVWXYZÄÖÑÜ§çabcdefghijklmnopqrstuvwxyzäöñüà"),
+	Portuguese: []rune("@£$¥êéúíóç\nÔô\rÁáΔ_ªÇÀ∞^\\€Ó|\x1bÂâÊÉ !\"#º%&'()*+,-./0123456789:;<=>?" +
+		"ÍABCDEFGHIJKLMNOPQRSTUVWXYZÃÕÚÜ§~abcdefghijklmnopqrstuvwxyzãõ`üà"),
+}
+
+// Single shift tables, septets following the escape.
+// See 3GPP TS 23.038 6.2.1.1 and annex A.2.
+var singleTables = map[Language]map[byte]rune{
+	Default: {
+		0x0A: '\f', 0x14: '^', 0x28: '{', 0x29: '}', 0x2F: '\\',
+		0x3C: '[', 0x3D: '~', 0x3E: ']', 0x40: '|', 0x65: '€',
+	},
+	Turkish: {
+		0x0A: '\f', 0x14: '^', 0x28: '{', 0x29: '}', 0x2F: '\\',
+		0x3C: '[', 0x3D: '~', 0x3E: ']', 0x40: '|', 0x47: 'Ğ',
+		0x49: 'İ', 0x53: 'Ş', 0x63: 'ç', 0x65: '€', 0x67: 'ğ',
+		0x69: 'ı', 0x73: 'ş',
+	},
+	Spanish: {
+		0x09: 'ç', 0x0A: '\f', 0x14: '^', 0x28: '{', 0x29: '}',
+		0x2F: '\\', 0x3C: '[', 0x3D: '~', 0x3E: ']', 0x40: '|',
+		0x41: 'Á', 0x49: 'Í', 0x4F: 'Ó', 0x55: 'Ú', 0x61: 'á',
+		0x65: '€', 0x69: 'í', 0x6F: 'ó', 0x75: 'ú',
+	},
+	Portuguese: {
+		0x05: 'ê', 0x09: 'ç', 0x0A: '\f', 0x0B: 'Ô', 0x0C: 'ô',
+		0x0E: 'Á', 0x0F: 'á', 0x12: 'Φ', 0x13: 'Γ', 0x14: '^',
+		0x15: 'Ω', 0x16: 'Π', 0x17: 'Ψ', 0x18: 'Σ', 0x19: 'Θ',
+		0x1F: 'Ê', 0x28: '{', 0x29: '}', 0x2F: '\\', 0x3C: '[',
+		0x3D: '~', 0x3E: ']', 0x40: '|', 0x41: 'À', 0x49: 'Í',
+		0x4F: 'Ó', 0x55: 'Ú', 0x5B: 'Ã', 0x5C: 'Õ', 0x61: 'Â',
+		0x65: '€', 0x69: 'í', 0x6F: 'ó', 0x75: 'ú', 0x7B: 'ã',
+		0x7C: 'õ', 0x7F: 'â',
+	},
+}
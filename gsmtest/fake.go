@@ -0,0 +1,195 @@
+// Package gsmtest provides backends for testing code that uses gsm without hardware.
+package gsmtest
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	gsm "github.com/gemaalief/gsmgo"
+	"github.com/gemaalief/gsmgo/gsm7"
+	"github.com/gemaalief/gsmgo/pdu"
+)
+
+var _ gsm.Backend = (*Fake)(nil)
+
+// Message passed to Fake.SendContext
+type Sent struct {
+	Text    string
+	Number  string
+	Options gsm.SendOptions
+	Result  *gsm.SendResult
+}
+
+// In-memory backend, safe for concurrent use.
+//
+// Sent messages are recorded, stored messages are added with Receive and
+// USSD replies are looked up by code.
+type Fake struct {
+	sync.Mutex
+
+	Sent   []*Sent
+	Stored []*gsm.Message
+	USSD   map[string]*gsm.USSDResponse // reply by code, unknown codes are not supported
+	State  gsm.DeviceStatus
+	Err    error // returned by every method if set
+
+	handler    func(*gsm.Message) error
+	reference  int
+	location   int
+	terminated bool
+}
+
+// Returns fake with a registered home network and full signal
+func NewFake() *Fake {
+	return &Fake{
+		USSD: make(map[string]*gsm.USSDResponse),
+		State: gsm.DeviceStatus{
+			SignalStrength: -51,
+			SignalPercent:  100,
+			BitErrorRate:   0,
+			BatteryPercent: -1,
+			Network:        gsm.NetworkHome,
+		},
+	}
+}
+
+// Records message, each part gets the next message reference
+func (f *Fake) SendContext(ctx context.Context, text, number string, opts ...gsm.SendOptions) (*gsm.SendResult, error) {
+	f.Lock()
+	defer f.Unlock()
+
+	if err := f.check(ctx); err != nil {
+		return nil, err
+	}
+
+	o := gsm.DefaultSendOptions()
+	if len(opts) > 0 {
+		o = opts[0]
+	}
+
+	result := &gsm.SendResult{Number: number, Sent: time.Now()}
+	s := pdu.NewSubmit(number, text)
+	if o.Unicode {
+		s.Alphabet, s.Tables = pdu.AlphabetUCS2, gsm7.Tables{}
+	}
+	parts, err := s.Split(0)
+	if err != nil {
+		return nil, &gsm.Error{Code: gsm.CodeInvalidData, Op: "send sms", Msg: err.Error()}
+	}
+	for range parts {
+		f.reference = (f.reference + 1) % 256
+		result.References = append(result.References, f.reference)
+	}
+
+	f.Sent = append(f.Sent, &Sent{Text: text, Number: number, Options: o, Result: result})
+	return result, nil
+}
+
+func (f *Fake) ReadSMSContext(ctx context.Context, delete bool) ([]*gsm.Message, error) {
+	f.Lock()
+	defer f.Unlock()
+
+	if err := f.check(ctx); err != nil {
+		return nil, err
+	}
+
+	messages := append([]*gsm.Message(nil), f.Stored...)
+	if delete {
+		f.Stored = nil
+	}
+	return messages, nil
+}
+
+// Deletes stored message with the location of msg
+func (f *Fake) DeleteSMSContext(ctx context.Context, msg *gsm.Message) error {
+	f.Lock()
+	defer f.Unlock()
+
+	if err := f.check(ctx); err != nil {
+		return err
+	}
+
+	for i, m := range f.Stored {
+		if m.Location == msg.Location {
+			f.Stored = append(f.Stored[:i], f.Stored[i+1:]...)
+			return nil
+		}
+	}
+	return gsm.ErrInvalidLocation
+}
+
+func (f *Fake) USSDContext(ctx context.Context, code string) (*gsm.USSDResponse, error) {
+	f.Lock()
+	defer f.Unlock()
+
+	if err := f.check(ctx); err != nil {
+		return nil, err
+	}
+
+	resp, ok := f.USSD[code]
+	if !ok {
+		return &gsm.USSDResponse{Status: gsm.USSDNotSupported, DCS: -1}, gsm.ErrNotSupported
+	}
+	return resp, nil
+}
+
+func (f *Fake) SetMessageHandler(fx func(*gsm.Message) error) {
+	f.Lock()
+	defer f.Unlock()
+
+	f.handler = fx
+}
+
+// Returns copy of State
+func (f *Fake) Status() (*gsm.DeviceStatus, error) {
+	f.Lock()
+	defer f.Unlock()
+
+	if err := f.check(context.Background()); err != nil {
+		return nil, err
+	}
+	status := f.State
+	return &status, nil
+}
+
+func (f *Fake) Terminate() error {
+	f.Lock()
+	defer f.Unlock()
+
+	f.terminated = true
+	return nil
+}
+
+// Stores incoming message at the next location and passes it to the message handler.
+// Returns the handler error.
+func (f *Fake) Receive(msg *gsm.Message) error {
+	f.Lock()
+	f.location++
+	msg.Location = f.location
+	if msg.PDU == 0 {
+		msg.PDU = gsm.PDUDeliver
+	}
+	if msg.State == 0 {
+		msg.State = gsm.StateUnread
+	}
+	f.Stored = append(f.Stored, msg)
+	handler := f.handler
+	f.Unlock()
+
+	if handler == nil {
+		return nil
+	}
+	return handler(msg)
+}
+
+// Returns error for calls after Terminate, on done ctx or set Err
+func (f *Fake) check(ctx context.Context) error {
+	if f.terminated {
+		return gsm.ErrNotConnected
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return f.Err
+}
@@ -0,0 +1,137 @@
+package gsmtest_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	gsm "github.com/gemaalief/gsmgo"
+	"github.com/gemaalief/gsmgo/gsmtest"
+)
+
+func TestFakeSend(t *testing.T) {
+	f := gsmtest.NewFake()
+	ctx := context.Background()
+
+	result, err := f.SendContext(ctx, strings.Repeat("x", 161), "+38164123456")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Number != "+38164123456" || result.Parts() != 2 || result.References[0] != 1 || result.References[1] != 2 {
+		t.Errorf("result = %+v", result)
+	}
+
+	// forced UCS-2 takes two parts for 71 characters, references go on
+	result, err = f.SendContext(ctx, strings.Repeat("x", 71), "+1", gsm.SendOptions{Unicode: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Parts() != 2 || result.References[0] != 3 {
+		t.Errorf("UCS-2 result = %+v", result)
+	}
+
+	if len(f.Sent) != 2 || f.Sent[0].Options != gsm.DefaultSendOptions() || !f.Sent[1].Options.Unicode {
+		t.Errorf("Sent = %+v", f.Sent)
+	}
+
+	// more than 255 parts
+	if _, err := f.SendContext(ctx, strings.Repeat("x", 153*256), "+1"); !errors.Is(err, gsm.ErrInvalidData) {
+		t.Errorf("too long err = %v", err)
+	}
+}
+
+func TestFakeReceive(t *testing.T) {
+	f := gsmtest.NewFake()
+	ctx := context.Background()
+
+	var handled []*gsm.Message
+	f.SetMessageHandler(func(msg *gsm.Message) error {
+		handled = append(handled, msg)
+		return nil
+	})
+	f.Receive(&gsm.Message{Number: "+1", Text: "first"})
+	f.Receive(&gsm.Message{Number: "+2", Text: "second"})
+
+	if len(handled) != 2 || handled[1].Location != 2 || handled[0].PDU != gsm.PDUDeliver || !handled[0].Unread() {
+		t.Fatalf("handled = %+v", handled)
+	}
+
+	if err := f.DeleteSMSContext(ctx, &gsm.Message{Location: 1}); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.DeleteSMSContext(ctx, &gsm.Message{Location: 1}); !errors.Is(err, gsm.ErrInvalidLocation) {
+		t.Errorf("second delete err = %v", err)
+	}
+
+	messages, err := f.ReadSMSContext(ctx, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(messages) != 1 || messages[0].Text != "second" {
+		t.Errorf("messages = %+v", messages)
+	}
+	if messages, _ = f.ReadSMSContext(ctx, false); len(messages) != 0 {
+		t.Errorf("%d messages left after delete", len(messages))
+	}
+
+	handlerErr := errors.New("handler failed")
+	f.SetMessageHandler(func(*gsm.Message) error { return handlerErr })
+	if err := f.Receive(&gsm.Message{}); err != handlerErr {
+		t.Errorf("Receive err = %v, want handler error", err)
+	}
+}
+
+func TestFakeUSSD(t *testing.T) {
+	f := gsmtest.NewFake()
+	ctx := context.Background()
+	f.USSD["*100#"] = &gsm.USSDResponse{Status: gsm.USSDNoActionNeeded, Text: "Balance 12.00", DCS: 15}
+
+	resp, err := f.USSDContext(ctx, "*100#")
+	if err != nil || resp.Text != "Balance 12.00" {
+		t.Errorf("USSD = %+v, %v", resp, err)
+	}
+
+	resp, err = f.USSDContext(ctx, "*999#")
+	if !errors.Is(err, gsm.ErrNotSupported) || resp.Status != gsm.USSDNotSupported {
+		t.Errorf("unknown code = %+v, %v", resp, err)
+	}
+}
+
+func TestFakeErrors(t *testing.T) {
+	f := gsmtest.NewFake()
+
+	status, err := f.Status()
+	if err != nil {
+		t.Fatal(err)
+	}
+	status.SignalPercent = 0
+	if f.State.SignalPercent != 100 || f.State.Network != gsm.NetworkHome {
+		t.Errorf("State = %+v", f.State)
+	}
+
+	f.Err = gsm.ErrNoSIM
+	if _, err := f.SendContext(context.Background(), "x", "+1"); !errors.Is(err, gsm.ErrNoSIM) {
+		t.Errorf("send with Err set = %v", err)
+	}
+	if _, err := f.Status(); !errors.Is(err, gsm.ErrNoSIM) {
+		t.Errorf("status with Err set = %v", err)
+	}
+	f.Err = nil
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := f.ReadSMSContext(ctx, false); !errors.Is(err, context.Canceled) {
+		t.Errorf("read on done context err = %v", err)
+	}
+
+	if err := f.Terminate(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.USSDContext(context.Background(), "*100#"); !errors.Is(err, gsm.ErrNotConnected) {
+		t.Errorf("USSD after Terminate err = %v", err)
+	}
+	if len(f.Sent) != 0 {
+		t.Errorf("failed sends recorded: %+v", f.Sent)
+	}
+}
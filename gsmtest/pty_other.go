@@ -0,0 +1,14 @@
+//go:build !linux
+
+package gsmtest
+
+import (
+	"os"
+
+	gsm "github.com/gemaalief/gsmgo"
+)
+
+// Pseudo-terminals are only supported on Linux
+func openPTY() (*os.File, string, error) {
+	return nil, "", gsm.ErrNotSupported
+}
@@ -0,0 +1,335 @@
+package gsmtest
+
+import (
+	"encoding/binary"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/tarm/serial"
+)
+
+// Telnet commands and options used by the RFC 2217 server
+const (
+	telnetSE   = 240
+	telnetSB   = 250
+	telnetWILL = 251
+	telnetWONT = 252
+	telnetDO   = 253
+	telnetDONT = 254
+	telnetIAC  = 255
+
+	optBinary  = 0
+	optSGA     = 3
+	optComPort = 44
+
+	comSetBaudrate = 1
+	comSetDatasize = 2
+	comSetParity   = 3
+	comSetStopsize = 4
+	comSetControl  = 5
+)
+
+// Serial settings as set over RFC 2217
+type SerialSettings struct {
+	Baud     int
+	DataSize int
+	Parity   int // 1 none, 2 odd, 3 even, 4 mark, 5 space
+	StopSize int // 1, 2 or 3 for 1.5
+	Control  int // flow control, 1 none, 2 XON/XOFF, 3 RTS/CTS
+}
+
+// Local stand-in for a serial port server such as ser2net, for tests of
+// tcp:// and rfc2217:// devices with gsm.NewModem(s.URL()).
+//
+// One connection at a time is bridged to the device, e.g. Simulator.Path. With
+// RFC 2217 the settings are only recorded, the device keeps its own.
+type SerialServer struct {
+	Addr    string // host:port
+	RFC2217 bool
+	Bauds   []int // baud rates accepted over RFC 2217, any if empty
+
+	listener net.Listener
+	port     *serial.Port
+	closed   chan struct{}
+
+	lock     sync.Mutex
+	conn     net.Conn
+	settings SerialSettings
+	wlock    sync.Mutex // serializes writes to conn
+}
+
+// Returns server on a free local port bridging connections to device
+func NewSerialServer(device string, rfc2217 bool) (*SerialServer, error) {
+	port, err := serial.OpenPort(&serial.Config{Name: device, Baud: 115200, ReadTimeout: 100 * time.Millisecond})
+	if err != nil {
+		return nil, err
+	}
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		port.Close()
+		return nil, err
+	}
+
+	s := &SerialServer{
+		Addr:     l.Addr().String(),
+		RFC2217:  rfc2217,
+		listener: l,
+		port:     port,
+		closed:   make(chan struct{}),
+		settings: SerialSettings{Baud: 115200, DataSize: 8, Parity: 1, StopSize: 1, Control: 1},
+	}
+	go s.accept()
+	go s.fromDevice()
+	return s, nil
+}
+
+// Returns device string for gsm.NewModem, tcp:// or rfc2217://
+func (s *SerialServer) URL() string {
+	if s.RFC2217 {
+		return "rfc2217://" + s.Addr
+	}
+	return "tcp://" + s.Addr
+}
+
+// Returns settings last set by the client
+func (s *SerialServer) Settings() SerialSettings {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.settings
+}
+
+// Stops listening and closes the connection and the device
+func (s *SerialServer) Close() error {
+	close(s.closed)
+	s.listener.Close()
+
+	s.lock.Lock()
+	if s.conn != nil {
+		s.conn.Close()
+	}
+	s.lock.Unlock()
+
+	return s.port.Close()
+}
+
+// Serves connections one at a time until Close
+func (s *SerialServer) accept() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+
+		s.lock.Lock()
+		s.conn = conn
+		s.lock.Unlock()
+
+		s.serve(conn)
+
+		s.lock.Lock()
+		s.conn = nil
+		s.lock.Unlock()
+		conn.Close()
+	}
+}
+
+// Copies device output to the connection, IAC is doubled with RFC 2217
+func (s *SerialServer) fromDevice() {
+	buf := make([]byte, 256)
+	for {
+		n, err := s.port.Read(buf)
+		if n > 0 {
+			data := buf[:n]
+			if s.RFC2217 {
+				data = escapeIAC(data)
+			}
+
+			s.lock.Lock()
+			conn := s.conn
+			s.lock.Unlock()
+			if conn != nil {
+				s.write(conn, data)
+			}
+		}
+		if err != nil {
+			select {
+			case <-s.closed:
+				return
+			default:
+			}
+			// read timeout is reported as EOF
+		}
+	}
+}
+
+// Reads the connection until it is closed, passing data to the device
+func (s *SerialServer) serve(conn net.Conn) {
+	buf := make([]byte, 256)
+	var state, cmd byte
+	var sb []byte
+
+	const (
+		stateData = iota
+		stateIAC
+		stateOption
+		stateSB
+		stateSBIAC
+	)
+
+	for {
+		n, err := conn.Read(buf)
+		if err != nil {
+			return
+		}
+		if !s.RFC2217 {
+			s.port.Write(buf[:n])
+			continue
+		}
+
+		var data []byte
+		for _, b := range buf[:n] {
+			switch state {
+			case stateData:
+				if b == telnetIAC {
+					state = stateIAC
+					continue
+				}
+				data = append(data, b)
+			case stateIAC:
+				switch b {
+				case telnetIAC:
+					data = append(data, b)
+					state = stateData
+				case telnetWILL, telnetWONT, telnetDO, telnetDONT:
+					cmd = b
+					state = stateOption
+				case telnetSB:
+					sb = sb[:0]
+					state = stateSB
+				default:
+					state = stateData
+				}
+			case stateOption:
+				s.option(conn, cmd, b)
+				state = stateData
+			case stateSB:
+				if b == telnetIAC {
+					state = stateSBIAC
+					continue
+				}
+				sb = append(sb, b)
+			case stateSBIAC:
+				switch b {
+				case telnetSE:
+					s.comPort(conn, sb)
+					state = stateData
+				case telnetIAC:
+					sb = append(sb, b)
+					state = stateSB
+				default:
+					state = stateData
+				}
+			}
+		}
+		if len(data) > 0 {
+			s.port.Write(data)
+		}
+	}
+}
+
+// Agrees to binary, suppress go ahead and COM-PORT-OPTION, refuses the rest
+func (s *SerialServer) option(conn net.Conn, cmd, opt byte) {
+	switch cmd {
+	case telnetWILL:
+		if opt == optBinary || opt == optSGA || opt == optComPort {
+			s.write(conn, []byte{telnetIAC, telnetDO, opt})
+		} else {
+			s.write(conn, []byte{telnetIAC, telnetDONT, opt})
+		}
+	case telnetDO:
+		if opt == optBinary || opt == optSGA {
+			s.write(conn, []byte{telnetIAC, telnetWILL, opt})
+		} else {
+			s.write(conn, []byte{telnetIAC, telnetWONT, opt})
+		}
+	}
+}
+
+// Applies COM-PORT-OPTION command and answers with the value in use, 0 asks for it
+func (s *SerialServer) comPort(conn net.Conn, sb []byte) {
+	if len(sb) < 3 || sb[0] != optComPort {
+		return
+	}
+	cmd, value := sb[1], sb[2:]
+
+	s.lock.Lock()
+	switch cmd {
+	case comSetBaudrate:
+		if len(value) < 4 {
+			s.lock.Unlock()
+			return
+		}
+		if baud := int(binary.BigEndian.Uint32(value)); baud != 0 && s.accepts(baud) {
+			s.settings.Baud = baud
+		}
+		value = make([]byte, 4)
+		binary.BigEndian.PutUint32(value, uint32(s.settings.Baud))
+	case comSetDatasize:
+		value = []byte{setting(&s.settings.DataSize, value[0])}
+	case comSetParity:
+		value = []byte{setting(&s.settings.Parity, value[0])}
+	case comSetStopsize:
+		value = []byte{setting(&s.settings.StopSize, value[0])}
+	case comSetControl:
+		if value[0] <= 3 {
+			value = []byte{setting(&s.settings.Control, value[0])}
+		}
+	}
+	s.lock.Unlock()
+
+	reply := append([]byte{telnetIAC, telnetSB, optComPort, cmd + 100}, escapeIAC(value)...)
+	s.write(conn, append(reply, telnetIAC, telnetSE))
+}
+
+// Returns true if baud is in Bauds or Bauds is empty
+func (s *SerialServer) accepts(baud int) bool {
+	if len(s.Bauds) == 0 {
+		return true
+	}
+	for _, b := range s.Bauds {
+		if b == baud {
+			return true
+		}
+	}
+	return false
+}
+
+// Sets field to value unless value is 0, returns the value in use
+func setting(field *int, value byte) byte {
+	if value != 0 {
+		*field = int(value)
+	}
+	return byte(*field)
+}
+
+func (s *SerialServer) write(conn net.Conn, data []byte) {
+	s.wlock.Lock()
+	defer s.wlock.Unlock()
+
+	conn.Write(data)
+}
+
+// Returns data with IAC doubled
+func escapeIAC(data []byte) []byte {
+	out := make([]byte, 0, len(data))
+	for _, b := range data {
+		out = append(out, b)
+		if b == telnetIAC {
+			out = append(out, telnetIAC)
+		}
+	}
+	return out
+}
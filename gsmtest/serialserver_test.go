@@ -0,0 +1,137 @@
+package gsmtest_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	gsm "github.com/gemaalief/gsmgo"
+	"github.com/gemaalief/gsmgo/gsmtest"
+)
+
+// Returns simulator behind a serial server, closed after the test
+func newServer(t *testing.T, rfc2217 bool) (*gsmtest.Simulator, *gsmtest.SerialServer) {
+	t.Helper()
+
+	sim, err := gsmtest.NewSimulator()
+	if errors.Is(err, gsm.ErrNotSupported) {
+		t.Skip(err)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv, err := gsmtest.NewSerialServer(sim.Path, rfc2217)
+	if err != nil {
+		sim.Close()
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		srv.Close()
+		sim.Close()
+	})
+	return sim, srv
+}
+
+func TestSerialServer(t *testing.T) {
+	for _, rfc2217 := range []bool{false, true} {
+		sim, srv := newServer(t, rfc2217)
+
+		m, err := gsm.NewModem(srv.URL())
+		if err != nil {
+			t.Fatalf("%s: %v", srv.URL(), err)
+		}
+
+		ctx := testContext(t)
+		resp, err := m.Exec(ctx, "AT+CGMI")
+		if err != nil {
+			t.Fatalf("%s: %v", srv.URL(), err)
+		}
+		if len(resp.Lines) != 1 || resp.Lines[0] != sim.Manufacturer {
+			t.Errorf("%s: AT+CGMI = %q", srv.URL(), resp.Lines)
+		}
+
+		// each part is sent after a "> " prompt and ends with Ctrl-Z
+		result, err := m.SendSMSContext(ctx, strings.Repeat("x", 200), "+1")
+		if err != nil {
+			t.Fatalf("%s: %v", srv.URL(), err)
+		}
+		if result.Parts() != 2 || len(sim.Submitted()) != 2 {
+			t.Errorf("%s: sent %d parts, simulator got %d", srv.URL(), result.Parts(), len(sim.Submitted()))
+		}
+		m.Close()
+	}
+}
+
+func TestSerialServerSettings(t *testing.T) {
+	_, srv := newServer(t, true)
+
+	m, err := gsm.NewModemWithConfig(gsm.ModemConfig{
+		Device:   srv.URL(),
+		Baud:     9600,
+		DataBits: 7,
+		Parity:   'E',
+		StopBits: 2,
+		RTSCTS:   true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+
+	want := gsmtest.SerialSettings{Baud: 9600, DataSize: 7, Parity: 3, StopSize: 2, Control: 3}
+	if got := srv.Settings(); got != want {
+		t.Errorf("Settings = %+v, want %+v", got, want)
+	}
+}
+
+func TestSerialServerBaudRejected(t *testing.T) {
+	_, srv := newServer(t, true)
+	srv.Bauds = []int{115200}
+
+	_, err := gsm.NewModemWithConfig(gsm.ModemConfig{Device: srv.URL(), Baud: 9600})
+	if !errors.Is(err, gsm.ErrNotSupported) {
+		t.Errorf("err = %v, want not supported", err)
+	}
+
+	// the server keeps serving at the accepted rate
+	m, err := gsm.NewModem(srv.URL())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+	if srv.Settings().Baud != 115200 {
+		t.Errorf("Baud = %d", srv.Settings().Baud)
+	}
+}
+
+func TestSerialServerClosed(t *testing.T) {
+	for _, rfc2217 := range []bool{false, true} {
+		sim, err := gsmtest.NewSimulator()
+		if errors.Is(err, gsm.ErrNotSupported) {
+			t.Skip(err)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer sim.Close()
+		srv, err := gsmtest.NewSerialServer(sim.Path, rfc2217)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		m, err := gsm.NewModem(srv.URL())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := m.Exec(testContext(t), "AT"); err != nil {
+			t.Fatal(err)
+		}
+
+		srv.Close()
+		if _, err := m.Exec(testContext(t), "AT"); !errors.Is(err, gsm.ErrDeviceIO) {
+			t.Errorf("%s: Exec after server closed err = %v, want device I/O error", srv.URL(), err)
+		}
+		m.Close()
+	}
+}
@@ -0,0 +1,439 @@
+package gsmtest
+
+import (
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	gsm "github.com/gemaalief/gsmgo"
+	"github.com/gemaalief/gsmgo/gsm7"
+	"github.com/gemaalief/gsmgo/pdu"
+)
+
+// Scripted AT modem on a pseudo-terminal, for tests with gsm.NewModem(s.Path).
+//
+// Common commands are answered from the exported fields, which should be set
+// before the port is opened. Messages sent with AT+CMGS are kept and returned by
+// Submitted, messages added with Receive or Deliver are listed by AT+CMGL.
+// Other commands are answered with ERROR unless a handler is added with Handle.
+type Simulator struct {
+	Path string // slave device
+
+	Manufacturer string
+	Model        string
+	Revision     string
+	IMEI         string
+	IMSI         string
+	ICCID        string
+	SMSC         string        // service centre of received messages
+	RSSI         int           // +CSQ signal, 0-31 or 99
+	BER          int           // +CSQ bit error rate, 0-7 or 99
+	Registration int           // +CREG <stat>, 1 for home network
+	Operator     string        // +COPS operator name
+	USSDDelay    time.Duration // delay of +CUSD after OK
+
+	master *os.File
+	closed chan struct{}
+	wlock  sync.Mutex // serializes writes to the master
+
+	lock      sync.Mutex
+	echo      bool
+	textMode  bool
+	handlers  []handler
+	ussd      map[string]ussdReply
+	stored    []*stored
+	index     int
+	reference int
+	submitted []*pdu.Submit
+	commands  []string
+}
+
+type handler struct {
+	prefix string
+	fn     func(cmd string) []string
+}
+
+type ussdReply struct {
+	status gsm.USSDStatus
+	text   string
+}
+
+// Message in the simulated SIM memory
+type stored struct {
+	index int
+	stat  int // +CMGL <stat>
+	pdu   []byte
+}
+
+// Returns simulator on a new pseudo-terminal, answering until Close
+func NewSimulator() (*Simulator, error) {
+	master, path, err := openPTY()
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Simulator{
+		Path:         path,
+		Manufacturer: "gsmgo",
+		Model:        "simulator",
+		Revision:     "1.0",
+		IMEI:         "490154203237518",
+		IMSI:         "001010123456789",
+		ICCID:        "8900101234567890123",
+		SMSC:         "+10000000000",
+		RSSI:         20,
+		BER:          0,
+		Registration: 1,
+		Operator:     "Test Network",
+		master:       master,
+		closed:       make(chan struct{}),
+		ussd:         make(map[string]ussdReply),
+	}
+	go s.run()
+	return s, nil
+}
+
+// Stops answering and closes the pseudo-terminal
+func (s *Simulator) Close() error {
+	close(s.closed)
+	return s.master.Close()
+}
+
+// Adds handler for commands starting with prefix, e.g. "AT+CBC", checked before
+// the built-in answers. The handler returns response lines including the final
+// result code.
+func (s *Simulator) Handle(prefix string, fn func(cmd string) []string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.handlers = append(s.handlers, handler{strings.ToUpper(prefix), fn})
+}
+
+// Sets reply to USSD code or menu input sent with AT+CUSD=1
+func (s *Simulator) USSD(code string, status gsm.USSDStatus, text string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.ussd[code] = ussdReply{status, text}
+}
+
+// Sends unsolicited result code, e.g. "RING"
+func (s *Simulator) Inject(line string) error {
+	return s.write(line)
+}
+
+// Stores text message from number and announces it with +CMTI, returns its index
+func (s *Simulator) Receive(number, text string) (int, error) {
+	d := &pdu.Deliver{SMSC: s.SMSC, Number: number, Timestamp: time.Now(), Class: -1, Text: text}
+	if !gsm7.Valid(text) {
+		d.Alphabet = pdu.AlphabetUCS2
+	}
+	return s.Deliver(d)
+}
+
+// Stores message and announces it with +CMTI, returns its index
+func (s *Simulator) Deliver(d *pdu.Deliver) (int, error) {
+	b, err := d.Encode()
+	if err != nil {
+		return 0, err
+	}
+
+	s.lock.Lock()
+	s.index++
+	index := s.index
+	s.stored = append(s.stored, &stored{index: index, stat: 0, pdu: b})
+	s.lock.Unlock()
+
+	return index, s.write(fmt.Sprintf("+CMTI: \"SM\",%d", index))
+}
+
+// Returns messages sent with AT+CMGS
+func (s *Simulator) Submitted() []*pdu.Submit {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return append([]*pdu.Submit(nil), s.submitted...)
+}
+
+// Returns received commands in order
+func (s *Simulator) Commands() []string {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return append([]string(nil), s.commands...)
+}
+
+// Reads commands from the master side until Close
+func (s *Simulator) run() {
+	buf := make([]byte, 256)
+	var line, body []byte
+	var prompt string // AT+CMGS command waiting for its PDU
+
+	for {
+		n, err := s.master.Read(buf)
+		if err != nil {
+			select {
+			case <-s.closed:
+				return
+			default:
+			}
+			// EIO while no process has the slave open
+			time.Sleep(50 * time.Millisecond)
+			continue
+		}
+
+		for _, b := range buf[:n] {
+			if prompt != "" {
+				switch b {
+				case 0x1A: // Ctrl-Z sends
+					s.submit(prompt, string(body))
+					prompt, body = "", body[:0]
+				case 0x1B: // escape cancels
+					s.write("OK")
+					prompt, body = "", body[:0]
+				default:
+					body = append(body, b)
+				}
+				continue
+			}
+
+			if b != '\r' && b != '\n' {
+				line = append(line, b)
+				continue
+			}
+			if len(line) > 0 {
+				if s.command(string(line)) {
+					prompt = string(line)
+				}
+				line = line[:0]
+			}
+		}
+	}
+}
+
+// Answers command, returns true if it waits for message text after "> "
+func (s *Simulator) command(cmd string) bool {
+	upper := strings.ToUpper(strings.TrimSpace(cmd))
+
+	s.lock.Lock()
+	s.commands = append(s.commands, cmd)
+	echo := s.echo
+	var fn func(string) []string
+	for _, h := range s.handlers {
+		if strings.HasPrefix(upper, h.prefix) {
+			fn = h.fn
+		}
+	}
+	s.lock.Unlock()
+
+	if echo {
+		s.raw(cmd + "\r")
+	}
+	if fn != nil {
+		s.write(fn(cmd)...)
+		return false
+	}
+
+	switch {
+	case upper == "AT", upper == "ATZ", upper == "AT&F":
+		s.write("OK")
+	case upper == "ATE0", upper == "ATE1":
+		s.lock.Lock()
+		s.echo = upper == "ATE1"
+		s.lock.Unlock()
+		s.write("OK")
+	case upper == "ATI":
+		s.write(s.Manufacturer, s.Model, "Revision: "+s.Revision, "OK")
+	case upper == "AT+CGMI", upper == "AT+GMI":
+		s.write(s.Manufacturer, "OK")
+	case upper == "AT+CGMM", upper == "AT+GMM":
+		s.write(s.Model, "OK")
+	case upper == "AT+CGMR", upper == "AT+GMR":
+		s.write(s.Revision, "OK")
+	case upper == "AT+CGSN", upper == "AT+GSN":
+		s.write(s.IMEI, "OK")
+	case upper == "AT+CIMI":
+		s.write(s.IMSI, "OK")
+	case upper == "AT+CCID":
+		s.write("+CCID: "+s.ICCID, "OK")
+	case upper == "AT+CSQ":
+		s.write(fmt.Sprintf("+CSQ: %d,%d", s.RSSI, s.BER), "OK")
+	case upper == "AT+CREG?":
+		s.write(fmt.Sprintf("+CREG: 0,%d", s.Registration), "OK")
+	case upper == "AT+COPS?":
+		s.write(fmt.Sprintf("+COPS: 0,0,\"%s\"", s.Operator), "OK")
+	case strings.HasPrefix(upper, "AT+CMGF="):
+		s.lock.Lock()
+		s.textMode = strings.TrimPrefix(upper, "AT+CMGF=") == "1"
+		s.lock.Unlock()
+		s.write("OK")
+	case strings.HasPrefix(upper, "AT+CMGS="):
+		s.lock.Lock()
+		textMode := s.textMode
+		s.lock.Unlock()
+		if textMode {
+			s.write("+CMS ERROR: 302")
+			return false
+		}
+		s.raw("\r\n> ")
+		return true
+	case strings.HasPrefix(upper, "AT+CMGL"):
+		s.list(upper)
+	case strings.HasPrefix(upper, "AT+CMGR="):
+		s.read(upper)
+	case strings.HasPrefix(upper, "AT+CMGD="):
+		s.delete(upper)
+	case strings.HasPrefix(upper, "AT+CUSD="):
+		s.dialUSSD(cmd)
+	case strings.HasPrefix(upper, "AT+CMEE"), strings.HasPrefix(upper, "AT+CSCS"),
+		strings.HasPrefix(upper, "AT+CNMI"), strings.HasPrefix(upper, "AT+CPMS"),
+		strings.HasPrefix(upper, "AT+CREG="), strings.HasPrefix(upper, "AT+COPS="),
+		strings.HasPrefix(upper, "AT+CSMS"):
+		s.write("OK")
+	default:
+		s.write("ERROR")
+	}
+	return false
+}
+
+// Stores PDU of AT+CMGS=<length> and answers with its message reference
+func (s *Simulator) submit(cmd, body string) {
+	length, _ := strconv.Atoi(cmd[strings.IndexByte(cmd, '=')+1:])
+
+	b, err := hex.DecodeString(strings.TrimSpace(body))
+	if err != nil || pdu.TPDULength(b) != length {
+		s.write("+CMS ERROR: 304")
+		return
+	}
+	decoded, err := pdu.Decode(b)
+	submit, ok := decoded.(*pdu.Submit)
+	if err != nil || !ok {
+		s.write("+CMS ERROR: 304")
+		return
+	}
+
+	s.lock.Lock()
+	s.reference = (s.reference + 1) % 256
+	ref := s.reference
+	s.submitted = append(s.submitted, submit)
+	s.lock.Unlock()
+
+	s.write(fmt.Sprintf("+CMGS: %d", ref), "OK")
+}
+
+// Answers AT+CMGL=<stat>, 4 lists all messages, unread ones are marked read
+func (s *Simulator) list(cmd string) {
+	stat := 4
+	if i := strings.IndexByte(cmd, '='); i >= 0 {
+		stat, _ = strconv.Atoi(cmd[i+1:])
+	}
+
+	s.lock.Lock()
+	var lines []string
+	for _, m := range s.stored {
+		if stat == 4 || stat == m.stat {
+			lines = append(lines, fmt.Sprintf("+CMGL: %d,%d,,%d", m.index, m.stat, pdu.TPDULength(m.pdu)),
+				strings.ToUpper(hex.EncodeToString(m.pdu)))
+			if m.stat == 0 {
+				m.stat = 1
+			}
+		}
+	}
+	s.lock.Unlock()
+
+	s.write(append(lines, "OK")...)
+}
+
+// Answers AT+CMGR=<index>
+func (s *Simulator) read(cmd string) {
+	index, _ := strconv.Atoi(cmd[len("AT+CMGR="):])
+
+	s.lock.Lock()
+	var lines []string
+	for _, m := range s.stored {
+		if m.index == index {
+			lines = []string{fmt.Sprintf("+CMGR: %d,,%d", m.stat, pdu.TPDULength(m.pdu)),
+				strings.ToUpper(hex.EncodeToString(m.pdu)), "OK"}
+			if m.stat == 0 {
+				m.stat = 1
+			}
+		}
+	}
+	s.lock.Unlock()
+
+	if lines == nil {
+		lines = []string{"+CMS ERROR: 321"}
+	}
+	s.write(lines...)
+}
+
+// Answers AT+CMGD=<index>
+func (s *Simulator) delete(cmd string) {
+	index, _ := strconv.Atoi(strings.SplitN(cmd[len("AT+CMGD="):], ",", 2)[0])
+
+	s.lock.Lock()
+	found := false
+	for i, m := range s.stored {
+		if m.index == index {
+			s.stored = append(s.stored[:i], s.stored[i+1:]...)
+			found = true
+			break
+		}
+	}
+	s.lock.Unlock()
+
+	if !found {
+		s.write("+CMS ERROR: 321")
+		return
+	}
+	s.write("OK")
+}
+
+// Answers AT+CUSD=1,"<code>"[,<dcs>] with OK and the reply as +CUSD after USSDDelay
+func (s *Simulator) dialUSSD(cmd string) {
+	parts := strings.SplitN(cmd[len("AT+CUSD="):], ",", 3)
+	if parts[0] != "1" || len(parts) < 2 {
+		s.write("OK")
+		return
+	}
+	code := strings.Trim(parts[1], "\"")
+
+	s.lock.Lock()
+	reply, ok := s.ussd[code]
+	s.lock.Unlock()
+
+	s.write("OK")
+
+	urc := "+CUSD: 4"
+	if ok {
+		urc = fmt.Sprintf("+CUSD: %d,\"%s\",15", reply.status, reply.text)
+	}
+	go func() {
+		select {
+		case <-time.After(s.USSDDelay):
+			s.write(urc)
+		case <-s.closed:
+		}
+	}()
+}
+
+// Writes lines, each surrounded by CR LF as modems do
+func (s *Simulator) write(lines ...string) error {
+	var b strings.Builder
+	for _, line := range lines {
+		b.WriteString("\r\n" + line + "\r\n")
+	}
+	return s.raw(b.String())
+}
+
+func (s *Simulator) raw(data string) error {
+	s.wlock.Lock()
+	defer s.wlock.Unlock()
+
+	_, err := s.master.Write([]byte(data))
+	return err
+}
@@ -0,0 +1,361 @@
+package gsmtest_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	gsm "github.com/gemaalief/gsmgo"
+	"github.com/gemaalief/gsmgo/gsmtest"
+)
+
+// Returns simulator and modem on its pseudo-terminal, both closed after the test
+func newModem(t *testing.T) (*gsmtest.Simulator, *gsm.Modem) {
+	t.Helper()
+
+	sim, err := gsmtest.NewSimulator()
+	if errors.Is(err, gsm.ErrNotSupported) {
+		t.Skip(err)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// short read timeout, closing the port waits for a pending read
+	m, err := gsm.NewModemWithConfig(gsm.ModemConfig{Device: sim.Path, ReadTimeout: 100 * time.Millisecond})
+	if err != nil {
+		sim.Close()
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		m.Close()
+		sim.Close()
+	})
+	return sim, m
+}
+
+func testContext(t *testing.T) context.Context {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	t.Cleanup(cancel)
+	return ctx
+}
+
+func TestExec(t *testing.T) {
+	sim, m := newModem(t)
+	ctx := testContext(t)
+
+	sim.Handle("AT+CPIN?", func(string) []string { return []string{"+CME ERROR: 10"} })
+
+	resp, err := m.Exec(ctx, "AT+CGSN")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Result != gsm.ResultOK || len(resp.Lines) != 1 || resp.Lines[0] != sim.IMEI {
+		t.Errorf("AT+CGSN = %+v", resp)
+	}
+
+	resp, err = m.Exec(ctx, "AT+CPIN?")
+	if !errors.Is(err, gsm.ErrNoSIM) {
+		t.Errorf("AT+CPIN? err = %v, want no SIM", err)
+	}
+	if resp == nil || resp.Result != gsm.ResultCME || resp.Code != 10 {
+		t.Errorf("AT+CPIN? = %+v", resp)
+	}
+
+	resp, err = m.Exec(ctx, "AT+UNKNOWN")
+	if err == nil || resp == nil || resp.Result != gsm.ResultError {
+		t.Errorf("AT+UNKNOWN = %+v, %v", resp, err)
+	}
+}
+
+func TestExecContext(t *testing.T) {
+	sim, m := newModem(t)
+
+	// no answer at all
+	sim.Handle("AT+SLOW", func(string) []string { return nil })
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	if _, err := m.Exec(ctx, "AT+SLOW"); !errors.Is(err, gsm.ErrTimeout) {
+		t.Errorf("err = %v, want timeout", err)
+	}
+
+	// modem is usable afterwards
+	if _, err := m.Exec(testContext(t), "AT"); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestURC(t *testing.T) {
+	sim, m := newModem(t)
+
+	rings := make(chan *gsm.URC, 1)
+	remove := m.Handle("RING", func(u *gsm.URC) { rings <- u })
+	defer remove()
+
+	if err := sim.Inject("RING"); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case u := <-rings:
+		if u.Prefix != "RING" {
+			t.Errorf("Prefix = %q", u.Prefix)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no RING")
+	}
+}
+
+func TestExecPrompt(t *testing.T) {
+	sim, m := newModem(t)
+	ctx := testContext(t)
+
+	text := strings.Repeat("long message ", 20)
+	result, err := m.SendSMSContext(ctx, text, "+38164123456")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Parts() != 2 || result.References[0] != 1 || result.References[1] != 2 {
+		t.Errorf("References = %v", result.References)
+	}
+
+	submitted := sim.Submitted()
+	if len(submitted) != 2 {
+		t.Fatalf("simulator got %d parts", len(submitted))
+	}
+	joined := ""
+	for _, s := range submitted {
+		if s.Number != "+38164123456" || s.Class != 1 || !s.StatusReport {
+			t.Errorf("part = %+v", s)
+		}
+		joined += s.Text
+	}
+	if joined != text {
+		t.Errorf("joined text = %q", joined)
+	}
+
+	// forced UCS-2 takes four parts for the same text
+	result, err = m.SendSMSContext(ctx, text, "+38164123456", gsm.SendOptions{Unicode: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Parts() != 4 {
+		t.Errorf("UCS-2 parts = %d, want 4", result.Parts())
+	}
+	if s := sim.Submitted()[2]; s.Class != -1 || s.StatusReport {
+		t.Errorf("zero options sent class %d, report %v", s.Class, s.StatusReport)
+	}
+}
+
+func TestATBackendReceive(t *testing.T) {
+	sim, m := newModem(t)
+	b := gsm.NewATBackend(m)
+
+	received := make(chan *gsm.Message, 1)
+	b.SetMessageHandler(func(msg *gsm.Message) error {
+		received <- msg
+		return nil
+	})
+
+	if _, err := sim.Receive("+38164000111", "Hello Ünïcode ж"); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case msg := <-received:
+		if msg.Number != "+38164000111" || msg.Text != "Hello Ünïcode ж" || msg.Coding != gsm.CodingUnicode {
+			t.Errorf("message = %+v", msg)
+		}
+		if msg.Location != 1 || !msg.Unread() {
+			t.Errorf("Location, State = %d, %v", msg.Location, msg.State)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no message")
+	}
+}
+
+func TestATBackendReadSMS(t *testing.T) {
+	sim, m := newModem(t)
+	ctx := testContext(t)
+	b := gsm.NewATBackend(m)
+
+	sim.Receive("+1", "first")
+	sim.Receive("+2", "second")
+
+	messages, err := b.ReadSMSContext(ctx, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(messages) != 2 || messages[0].Text != "first" || messages[1].Number != "+2" {
+		t.Fatalf("messages = %+v", messages)
+	}
+
+	messages, err = b.ReadSMSContext(ctx, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(messages) != 0 {
+		t.Errorf("%d messages left after delete", len(messages))
+	}
+
+	err = b.DeleteSMSContext(ctx, &gsm.Message{Location: 7})
+	if !errors.Is(err, gsm.ErrInvalidLocation) {
+		t.Errorf("delete missing message err = %v", err)
+	}
+}
+
+func TestATBackendStatus(t *testing.T) {
+	sim, m := newModem(t)
+	sim.RSSI, sim.Registration = 31, 5
+	b := gsm.NewATBackend(m)
+
+	status, err := b.Status()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.SignalPercent != 100 || status.SignalStrength != -51 {
+		t.Errorf("signal = %d%%, %d dBm", status.SignalPercent, status.SignalStrength)
+	}
+	if status.Network != gsm.NetworkRoaming || status.OperatorName != sim.Operator {
+		t.Errorf("network = %v, %q", status.Network, status.OperatorName)
+	}
+	if status.BatteryPercent != -1 {
+		t.Errorf("BatteryPercent = %d", status.BatteryPercent)
+	}
+}
+
+func TestATBackendInfo(t *testing.T) {
+	sim, m := newModem(t)
+	b := gsm.NewATBackend(m)
+
+	info, err := b.Info()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := gsm.DeviceInfo{
+		Manufacturer: sim.Manufacturer,
+		Model:        sim.Model,
+		Firmware:     sim.Revision,
+		IMEI:         sim.IMEI,
+		IMSI:         sim.IMSI,
+		ICCID:        sim.ICCID,
+	}
+	if *info != want {
+		t.Errorf("Info = %+v, want %+v", info, want)
+	}
+
+	// Huawei modems answer AT^ICCID? only, no SIM leaves the IMSI empty
+	sim.Handle("AT+CCID", func(string) []string { return []string{"ERROR"} })
+	sim.Handle("AT^ICCID?", func(string) []string { return []string{"^ICCID: 89860000000000000001", "OK"} })
+	sim.Handle("AT+CIMI", func(string) []string { return []string{"+CME ERROR: 10"} })
+
+	if info, err = b.Info(); err != nil {
+		t.Fatal(err)
+	}
+	if info.ICCID != "89860000000000000001" || info.IMSI != "" || info.IMEI != sim.IMEI {
+		t.Errorf("Info = %+v", info)
+	}
+}
+
+func TestProbePorts(t *testing.T) {
+	sim, err := gsmtest.NewSimulator()
+	if errors.Is(err, gsm.ErrNotSupported) {
+		t.Skip(err)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sim.Close()
+
+	ports := gsm.ProbePorts(testContext(t), "/dev/gsmgo-missing", sim.Path)
+	if len(ports) != 1 {
+		t.Fatalf("ports = %+v", ports)
+	}
+	p := ports[0]
+	if p.Device != sim.Path || p.Port == "" || p.Manufacturer != sim.Manufacturer || p.Model != sim.Model || p.IMEI != sim.IMEI {
+		t.Errorf("port = %+v", p)
+	}
+}
+
+func TestUSSDSession(t *testing.T) {
+	sim, m := newModem(t)
+	ctx := testContext(t)
+
+	sim.USSD("*100#", gsm.USSDActionNeeded, "1 Balance 2 Voucher")
+	sim.USSD("2", gsm.USSDActionNeeded, "Enter code")
+	sim.USSD("12345678", gsm.USSDNoActionNeeded, "Voucher 12345678 used")
+
+	s := gsm.NewUSSDSession(m)
+	resp, err := s.StartContext(ctx, "*100#")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Text != "1 Balance 2 Voucher" || !s.Waiting() {
+		t.Errorf("menu = %+v", resp)
+	}
+
+	if resp, err = s.ReplyContext(ctx, "2"); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Text != "Enter code" {
+		t.Errorf("reply = %+v", resp)
+	}
+
+	// numeric text is passed through, not decoded as hex
+	if resp, err = s.ReplyContext(ctx, "12345678"); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Text != "Voucher 12345678 used" || s.Waiting() {
+		t.Errorf("reply = %+v", resp)
+	}
+
+	if _, err = s.ReplyContext(ctx, "1"); !errors.Is(err, gsm.ErrInvalidData) {
+		t.Errorf("reply after end err = %v", err)
+	}
+}
+
+func TestUSSDSessionCancel(t *testing.T) {
+	sim, m := newModem(t)
+	ctx := testContext(t)
+
+	sim.USSD("*123#", gsm.USSDActionNeeded, "Menu")
+
+	s := gsm.NewUSSDSession(m)
+	if _, err := s.StartContext(ctx, "*123#"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.CancelContext(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if s.Waiting() || s.Last() != nil {
+		t.Error("session still waiting after cancel")
+	}
+
+	commands := sim.Commands()
+	if last := commands[len(commands)-1]; last != "AT+CUSD=2" {
+		t.Errorf("last command = %q", last)
+	}
+
+	if _, err := s.StartContext(ctx, "*999#"); !errors.Is(err, gsm.ErrNotSupported) {
+		t.Errorf("unknown code err = %v", err)
+	}
+}
+
+func TestUSSDSessionPacked(t *testing.T) {
+	sim, m := newModem(t)
+	ctx := testContext(t)
+
+	// Huawei modems take and return hex of packed septets
+	sim.USSD("AA180C3602", gsm.USSDNoActionNeeded, "C2303BEC1E974131990B0603")
+
+	s := gsm.NewUSSDSession(m)
+	s.Packed = true
+	resp, err := s.StartContext(ctx, "*100#")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Text != "Balance 12.00" {
+		t.Errorf("Text = %q, want Balance 12.00", resp.Text)
+	}
+}
@@ -0,0 +1,65 @@
+package gsm
+
+// Device and SIM identification
+type DeviceInfo struct {
+	Manufacturer string
+	Model        string
+	Firmware     string
+	IMEI         string
+	IMSI         string
+	ICCID        string // empty if the backend can not read it
+}
+
+// Network registration state
+type NetworkState int
+
+const (
+	NetworkUnknown   NetworkState = iota
+	NetworkHome                   // registered, home network
+	NetworkRoaming                // registered, roaming
+	NetworkSearching              // not registered, searching
+	NetworkNone                   // not registered, not searching
+	NetworkDenied                 // registration denied
+)
+
+func (s NetworkState) String() string {
+	switch s {
+	case NetworkHome:
+		return "home"
+	case NetworkRoaming:
+		return "roaming"
+	case NetworkSearching:
+		return "searching"
+	case NetworkNone:
+		return "none"
+	case NetworkDenied:
+		return "denied"
+	}
+	return "unknown"
+}
+
+// Returns true if registered to home or roaming network
+func (s NetworkState) Registered() bool {
+	return s == NetworkHome || s == NetworkRoaming
+}
+
+// Signal, battery and network status
+type DeviceStatus struct {
+	SignalStrength int // dBm, 0 if unknown
+	SignalPercent  int // -1 if unknown
+	BitErrorRate   int // percent, -1 if unknown
+
+	BatteryPercent int // -1 if unknown
+	Charging       bool
+
+	Network      NetworkState
+	OperatorName string
+	OperatorCode string // MCC and MNC
+	LAC          string // location area code, hex
+	CellID       string // hex
+}
+
+// Returns true if err is nil or the device does not provide the value
+func optional(err error) bool {
+	return err == nil || isCode(err, CodeNotSupported, CodeNotImplemented, CodeEmpty)
+}
@@ -0,0 +1,132 @@
+package gsm
+
+import (
+	"time"
+)
+
+// Message state in phone memory
+type State int
+
+const (
+	StateSent State = iota + 1
+	StateUnsent
+	StateRead
+	StateUnread
+)
+
+// Message data coding
+type Coding int
+
+const (
+	CodingUnicode Coding = iota + 1
+	CodingUnicodeCompressed
+	CodingDefault
+	CodingDefaultCompressed
+	Coding8bit
+)
+
+// Message PDU type
+type PDUType int
+
+const (
+	PDUDeliver PDUType = iota + 1
+	PDUStatusReport
+	PDUSubmit
+)
+
+// User data header of a message
+type UDH struct {
+	ID    int    // concatenated message reference, -1 if not concatenated
+	Part  int    // part number, starting at 1
+	Parts int    // total number of parts
+	Data  []byte // raw header, including the length octet
+}
+
+// SMS message
+type Message struct {
+	Location int
+	Folder   int
+	Number   string
+	Text     string
+	Data     []byte // payload of 8-bit messages, Text is empty for those
+
+	SrcPort int // source port from UDH, -1 if none
+	DstPort int // destination port from UDH, -1 if none
+
+	SMSC     string    // service centre number
+	SMSCTime time.Time // service centre timestamp
+	DateTime time.Time // sent or received time as stored by the phone
+
+	State            State
+	Coding           Coding
+	Class            int // message class 0-3, -1 if none
+	PDU              PDUType
+	UDH              UDH
+	MessageReference int
+	DeliveryStatus   int // TP-ST of status reports
+}
+
+// SmsRead is kept for compatibility, use Message
+type SmsRead = Message
+
+// Returns true for 8-bit data messages
+func (m *Message) Binary() bool {
+	return m.Coding == Coding8bit
+}
+
+// Returns true if message was not read yet
+func (m *Message) Unread() bool {
+	return m.State == StateUnread
+}
+
+// UDH information elements for application port addressing
+const (
+	iePorts8bit  = 0x04
+	iePorts16bit = 0x05
+)
+
+// Returns source and destination ports from UDH, -1 if not present
+func udhPorts(udh []byte) (src, dst int) {
+	src, dst = -1, -1
+	if len(udh) < 1 {
+		return
+	}
+
+	// skip the header length octet
+	ies := udh[1:]
+	if int(udh[0]) < len(ies) {
+		ies = ies[:udh[0]]
+	}
+
+	for len(ies) >= 2 {
+		id, length := ies[0], int(ies[1])
+		if len(ies) < 2+length {
+			break
+		}
+		data := ies[2 : 2+length]
+		switch {
+		case id == iePorts8bit && length == 2:
+			dst, src = int(data[0]), int(data[1])
+		case id == iePorts16bit && length == 4:
+			dst, src = int(data[0])<<8|int(data[1]), int(data[2])<<8|int(data[3])
+		}
+		ies = ies[2+length:]
+	}
+
+	return
+}
+
+// Returns UDH with 16-bit application port addressing, nil if both ports are negative
+func portsUDH(src, dst int) []byte {
+	if src < 0 && dst < 0 {
+		return nil
+	}
+	if src < 0 {
+		src = 0
+	}
+	if dst < 0 {
+		dst = 0
+	}
+
+	return []byte{6, iePorts16bit, 4, byte(dst >> 8), byte(dst), byte(src >> 8), byte(src)}
+}
@@ -1,23 +1,42 @@
 package gsm
 
 import (
-	"bufio"
 	"context"
 	"errors"
+	"io"
 	"log"
 	"strings"
+	"sync"
 	"time"
-
-	"github.com/tarm/serial"
 )
 
 const (
 	baud    = 115200
 	timeOut = 5 * time.Second
+	prompt  = "> " // modem waits for message text
 )
 
+// AT modem on a serial port or any other transport.
+//
+// A background reader splits lines sent by the modem into command responses,
+// returned by Read and Expect, and unsolicited result codes, passed to
+// handlers registered with Handle.
 type Modem struct {
-	Port *serial.Port
+	Port io.ReadWriteCloser
+
+	lines chan string // command response lines
+	urcs  chan *URC
+	err   error // read error, set before lines is closed
+
+	readTimeout time.Duration // silence ending Read and Expect
+
+	cmdLock sync.Mutex // held by Exec while waiting for the result
+
+	lock      sync.Mutex
+	pending   string // information response prefix of the running command
+	handlers  map[string][]*urcHandler
+	concatRef uint8 // reference of the last multipart message
+	recorder  *recorder
 }
 
 type respChan struct {
@@ -25,42 +44,106 @@ type respChan struct {
 	err    error
 }
 
+// Unsolicited result code sent by the modem
+type URC struct {
+	Prefix string // e.g. "+CMTI" or "RING"
+	Line   string // whole line
+	Params string // text after the prefix and colon
+	Data   string // following line of +CMT, +CDS and +CBM, PDU or text
+}
+
+// Function called for unsolicited result codes
+type URCHandler func(*URC)
+
+type urcHandler struct {
+	fn URCHandler
+}
+
+// Result codes the modem may send at any time
+var knownURCs = map[string]bool{
+	"+CMTI": true, "+CMT": true, "+CDSI": true, "+CDS": true, "+CBM": true,
+	"+CUSD": true, "RING": true, "+CRING": true, "+CLIP": true,
+	"+CREG": true, "+CGREG": true, "+CEREG": true,
+}
+
+// Result codes followed by a line of data
+var urcData = map[string]bool{
+	"+CMT": true, "+CDS": true, "+CBM": true,
+}
+
+// Set commands whose result arrives as result code after OK
+var urcOnSet = map[string]bool{
+	"+CUSD": true,
+}
+
 func NewModem(deviceName string) (*Modem, error) {
+	return NewModemWithConfig(ModemConfig{Device: deviceName})
+}
 
-	config := &serial.Config{Name: deviceName, Baud: baud, ReadTimeout: timeOut}
-	con, err := serial.OpenPort(config)
-	if err != nil {
-		return nil, err
-	}
+// Returns modem talking over port, e.g. a Replay. Reads may block, io.EOF is
+// treated as a read timeout.
+func NewModemPort(port io.ReadWriteCloser) *Modem {
+	m := &Modem{
+		Port:     port,
+		lines:    make(chan string, 64),
+		urcs:     make(chan *URC, 64),
+		handlers: make(map[string][]*urcHandler),
+
+		readTimeout: timeOut,
 
-	return &Modem{Port: con}, nil
+		// references should not repeat between restarts
+		concatRef: uint8(time.Now().UnixNano()),
+	}
+	go m.reader()
+	go m.dispatch()
+	return m
 }
 
-func (m *Modem) Expect(possibilities []string) (string, error) {
-	readMax := 2000
-	for _, possibility := range possibilities {
-		length := len(possibility)
-		if length > readMax {
-			readMax = length
+// Registers handler for result codes with prefix, e.g. "+CMTI" or "RING".
+//
+// Handlers run in order on a single goroutine and may send commands.
+// Returns function removing the handler.
+func (m *Modem) Handle(prefix string, fn URCHandler) (remove func()) {
+	h := &urcHandler{fn}
+
+	m.lock.Lock()
+	m.handlers[prefix] = append(m.handlers[prefix], h)
+	m.lock.Unlock()
+
+	return func() {
+		m.lock.Lock()
+		defer m.lock.Unlock()
+
+		hs := m.handlers[prefix]
+		for i := range hs {
+			if hs[i] == h {
+				m.handlers[prefix] = append(hs[:i:i], hs[i+1:]...)
+				break
+			}
+		}
+		if len(m.handlers[prefix]) == 0 {
+			delete(m.handlers, prefix)
 		}
 	}
+}
 
-	readMax = readMax + 2 // we need offset for \r\n sent by modem
-
+func (m *Modem) Expect(possibilities []string) (string, error) {
 	var status string = ""
-	buf := make([]byte, readMax)
-
-	for i := 0; i < readMax; i++ {
-		// ignoring error as EOF raises error on Linux
-		n, _ := m.Port.Read(buf)
-		if n > 0 {
-			status = string(buf[:n])
-
-			for _, possibility := range possibilities {
-				if strings.HasSuffix(status, possibility) {
-					log.Println("--- Expect:", m.transposeLog(strings.Join(possibilities, "|")), "Got:", m.transposeLog(status))
-					return status, nil
-				}
+	for {
+		line, err := m.readLine(m.readTimeout)
+		if err != nil {
+			break
+		}
+		if line == prompt {
+			status += line
+		} else {
+			status += line + "\r\n"
+		}
+
+		for _, possibility := range possibilities {
+			if strings.HasSuffix(status, possibility) {
+				log.Println("--- Expect:", m.transposeLog(strings.Join(possibilities, "|")), "Got:", m.transposeLog(status))
+				return status, nil
 			}
 		}
 	}
@@ -71,46 +154,28 @@ func (m *Modem) Expect(possibilities []string) (string, error) {
 
 func (m *Modem) Send(command string) {
 	log.Println("--- Send:", m.transposeLog(command))
-	m.Port.Flush()
-	_, err := m.Port.Write([]byte(command))
+	m.drain()
+	m.setPending(command)
+	err := m.write(command)
 	if err != nil {
 		log.Fatal(err)
 	}
 }
 
+// Returns response lines received until the modem stays silent for the read timeout
 func (m *Modem) Read() (string, error) {
-	var output string = ""
-	scanner := bufio.NewScanner(m.Port)
-	for scanner.Scan() {
-		output += scanner.Text()
-	}
-	if err := scanner.Err(); err != nil {
-		return "", err
-	}
-	return output, nil
+	return m.readLines(context.Background())
 }
 
 func (m *Modem) ReadWithTimeout(ctx context.Context) (string, error) {
-	select {
-	case <-ctx.Done():
-		return "", errors.New("context timeout, ran out of time")
-	case respChan := <-m.ReadWithContext(ctx):
-		return respChan.result, respChan.err
-	}
+	return m.readLines(ctx)
 }
 
 func (m *Modem) ReadWithContext(ctx context.Context) <-chan *respChan {
 	r := make(chan *respChan, 1)
 	go func() {
-		result, err := m.Read()
-		if err != nil {
-			r <- &respChan{"", err}
-			return
-		}
-		if !strings.HasSuffix(result, "\"Terima") {
-			r <- &respChan{result, nil}
-		}
-		return
+		result, err := m.readLines(ctx)
+		r <- &respChan{result, err}
 	}()
 	return r
 }
@@ -131,6 +196,205 @@ func (m *Modem) transposeLog(input string) string {
 	return strings.Replace(output, "\r", "\\r", -1)
 }
 
-func (m *Modem) close() error {
+// Closes the port and the transcript, the background reader stops
+func (m *Modem) Close() error {
+	m.Record("")
 	return m.Port.Close()
 }
+
+// Returns next response line, waits at most timeout
+func (m *Modem) readLine(timeout time.Duration) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return m.readLineContext(ctx)
+}
+
+// Returns next response line, waits until ctx is done
+func (m *Modem) readLineContext(ctx context.Context) (string, error) {
+	select {
+	case line, ok := <-m.lines:
+		if !ok {
+			return "", m.err
+		}
+		return line, nil
+	case <-ctx.Done():
+		return "", contextError(ctx, "read")
+	}
+}
+
+// Returns response lines joined by newline, until the modem stays silent for the read timeout
+func (m *Modem) readLines(ctx context.Context) (string, error) {
+	var lines []string
+	idle := time.NewTimer(m.readTimeout)
+	defer idle.Stop()
+
+	for {
+		select {
+		case line, ok := <-m.lines:
+			if !ok {
+				if len(lines) == 0 {
+					return "", m.err
+				}
+				return strings.Join(lines, "\n"), nil
+			}
+			lines = append(lines, line)
+			if !idle.Stop() {
+				<-idle.C
+			}
+			idle.Reset(m.readTimeout)
+		case <-idle.C:
+			return strings.Join(lines, "\n"), nil
+		case <-ctx.Done():
+			return "", contextError(ctx, "read")
+		}
+	}
+}
+
+// Drops response lines left from earlier commands
+func (m *Modem) drain() {
+	for {
+		select {
+		case line, ok := <-m.lines:
+			if !ok {
+				return
+			}
+			log.Println("--- Drop:", m.transposeLog(line))
+		default:
+			return
+		}
+	}
+}
+
+// Remembers information response prefix of command, e.g. "+CSQ" for "AT+CSQ"
+func (m *Modem) setPending(command string) {
+	cmd := strings.ToUpper(strings.TrimSpace(command))
+	cmd = strings.TrimPrefix(cmd, "AT")
+
+	prefix := ""
+	if strings.HasPrefix(cmd, "+") || strings.HasPrefix(cmd, "^") {
+		prefix = cmd
+		if i := strings.IndexAny(cmd, "=?;"); i >= 0 {
+			prefix = cmd[:i]
+			set := cmd[i] == '=' && !strings.HasPrefix(cmd[i:], "=?")
+			if set && urcOnSet[prefix] {
+				prefix = ""
+			}
+		}
+	}
+
+	m.lock.Lock()
+	m.pending = prefix
+	m.lock.Unlock()
+}
+
+// Returns prefix of a response line, the part before colon or the whole line
+func linePrefix(line string) string {
+	if i := strings.IndexByte(line, ':'); i > 0 && (line[0] == '+' || line[0] == '^') {
+		return line[:i]
+	}
+	return line
+}
+
+// Reports whether lines with prefix are result codes instead of a command response
+func (m *Modem) isURC(prefix string) bool {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if prefix == m.pending {
+		return false
+	}
+	if _, ok := m.handlers[prefix]; ok {
+		return true
+	}
+	return knownURCs[prefix]
+}
+
+// Reads the port and splits lines into responses and result codes
+func (m *Modem) reader() {
+	defer close(m.urcs)
+
+	buf := make([]byte, 256)
+	var line []byte
+	var urc *URC // waiting for its data line
+
+	emit := func(s string) {
+		if urc != nil {
+			urc.Data = s
+			m.urcs <- urc
+			urc = nil
+			return
+		}
+
+		prefix := linePrefix(s)
+		if m.isURC(prefix) {
+			u := &URC{Prefix: prefix, Line: s, Params: strings.TrimSpace(strings.TrimPrefix(s[len(prefix):], ":"))}
+			if urcData[prefix] {
+				urc = u
+				return
+			}
+			m.urcs <- u
+			return
+		}
+
+		if finalResponse(s) != nil {
+			m.lock.Lock()
+			m.pending = ""
+			m.lock.Unlock()
+		}
+		select {
+		case m.lines <- s:
+		default:
+			log.Println("--- Drop:", m.transposeLog(s))
+		}
+	}
+
+	for {
+		n, err := m.Port.Read(buf)
+		m.record(received, buf[:n])
+		for _, b := range buf[:n] {
+			if b != '\r' && b != '\n' {
+				line = append(line, b)
+				continue
+			}
+			// quoted text of e.g. +CUSD may span lines
+			if len(line) > 0 && line[0] == '+' && strings.Count(string(line), "\"")%2 == 1 {
+				if b == '\n' {
+					line = append(line, b)
+				}
+				continue
+			}
+			if len(line) > 0 {
+				emit(string(line))
+			}
+			line = line[:0]
+		}
+		// prompt for message text is not terminated by newline
+		if string(line) == prompt {
+			emit(prompt)
+			line = line[:0]
+		}
+
+		// read timeout is reported as EOF on Linux
+		if err != nil && err != io.EOF {
+			m.err = &Error{Code: CodeDeviceIO, Op: "read", Msg: err.Error()}
+			close(m.lines)
+			return
+		}
+	}
+}
+
+// Passes result codes to handlers
+func (m *Modem) dispatch() {
+	for u := range m.urcs {
+		m.lock.Lock()
+		hs := append([]*urcHandler(nil), m.handlers[u.Prefix]...)
+		m.lock.Unlock()
+
+		if len(hs) == 0 {
+			log.Println("--- URC:", m.transposeLog(u.Line), "(no handler)")
+		}
+		for _, h := range hs {
+			h.fn(u)
+		}
+	}
+}
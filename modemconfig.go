@@ -0,0 +1,198 @@
+package gsm
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tarm/serial"
+)
+
+// Serial port settings of a Modem, zero values select the defaults.
+//
+// Device is a serial device, tcp://host:port for a raw socket or
+// rfc2217://host:port for a Telnet COM Port Control server, which is sent the
+// settings. Settings of a raw socket are up to the server.
+type ModemConfig struct {
+	Device      string
+	Baud        int           // 115200 if 0
+	DataBits    int           // 5 to 8, 8 if 0
+	Parity      byte          // 'N', 'O', 'E', none if 0, 'M' or 'S' over rfc2217 only
+	StopBits    int           // 1 or 2, 1 if 0
+	RTSCTS      bool          // hardware flow control
+	ReadTimeout time.Duration // silence ending Read and Expect, 5s if 0
+}
+
+// Returns modem on the serial port described by config
+func NewModemWithConfig(config ModemConfig) (*Modem, error) {
+	port, err := openPort(config)
+	if err != nil {
+		return nil, err
+	}
+	m := NewModemPort(port)
+	if config.ReadTimeout > 0 {
+		m.readTimeout = config.ReadTimeout
+	}
+	return m, nil
+}
+
+// Opens serial device or connects to network serial port
+func openPort(config ModemConfig) (io.ReadWriteCloser, error) {
+	switch {
+	case strings.HasPrefix(config.Device, schemeTCP):
+		return dialTCP(config.Device)
+	case strings.HasPrefix(config.Device, schemeRFC2217):
+		return dialRFC2217(config)
+	}
+
+	con, err := serial.OpenPort(config.serial())
+	if err != nil {
+		return nil, err
+	}
+
+	if config.RTSCTS {
+		if err = setRTSCTS(config.Device); err != nil {
+			con.Close()
+			return nil, err
+		}
+	}
+	return con, nil
+}
+
+// Returns tarm/serial config with defaults filled in
+func (c ModemConfig) serial() *serial.Config {
+	s := &serial.Config{
+		Name:        c.Device,
+		Baud:        c.Baud,
+		ReadTimeout: c.ReadTimeout,
+		Size:        byte(c.DataBits),
+		Parity:      serial.Parity(c.Parity),
+		StopBits:    serial.StopBits(c.StopBits),
+	}
+	if s.Baud == 0 {
+		s.Baud = baud
+	}
+	if s.ReadTimeout == 0 {
+		s.ReadTimeout = timeOut
+	}
+	return s
+}
+
+// Reads modem settings from gammu config section, section 0 is [gammu].
+//
+// Besides device, the section may set baudrate, databits, parity (none, odd,
+// even, mark and space for rfc2217 devices only), stopbits, flowcontrol (none, rtscts) and readtimeout
+// (e.g. 5s), keys gammu ignores. Without baudrate the speed of connection,
+// e.g. at19200, is used.
+func ReadModemConfig(path string, section int) (config ModemConfig, err error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+
+	sections, err := parseINI(f)
+	if err != nil {
+		return
+	}
+
+	name := "gammu"
+	if section != 0 {
+		name += strconv.Itoa(section)
+	}
+	keys, ok := sections[name]
+	if !ok {
+		err = fmt.Errorf("%s: section [%s] not found", path, name)
+		return
+	}
+
+	config.Device = keys["device"]
+	if config.Device == "" {
+		err = fmt.Errorf("%s: [%s] has no device", path, name)
+		return
+	}
+
+	if conn := strings.ToLower(keys["connection"]); strings.HasPrefix(conn, "at") && len(conn) > 2 {
+		config.Baud, _ = strconv.Atoi(conn[2:])
+	}
+
+	for key, value := range keys {
+		switch key {
+		case "baudrate":
+			config.Baud, err = strconv.Atoi(value)
+		case "databits":
+			config.DataBits, err = strconv.Atoi(value)
+		case "stopbits":
+			config.StopBits, err = strconv.Atoi(value)
+		case "parity":
+			switch strings.ToLower(value) {
+			case "none", "n":
+				config.Parity = 'N'
+			case "odd", "o":
+				config.Parity = 'O'
+			case "even", "e":
+				config.Parity = 'E'
+			case "mark", "m":
+				config.Parity = 'M'
+			case "space", "s":
+				config.Parity = 'S'
+			default:
+				err = fmt.Errorf("unknown parity")
+			}
+			// tarm/serial opening local ports knows neither mark nor space
+			if (config.Parity == 'M' || config.Parity == 'S') && !strings.HasPrefix(config.Device, schemeRFC2217) {
+				err = fmt.Errorf("parity supported over rfc2217 only")
+			}
+		case "flowcontrol":
+			switch strings.ToLower(value) {
+			case "none", "":
+				config.RTSCTS = false
+			case "rtscts", "hardware":
+				config.RTSCTS = true
+			default:
+				err = fmt.Errorf("unknown flow control")
+			}
+		case "readtimeout":
+			config.ReadTimeout, err = time.ParseDuration(value)
+		}
+		if err != nil {
+			err = fmt.Errorf("%s: [%s] %s = %s: %v", path, name, key, value, err)
+			return
+		}
+	}
+	return
+}
+
+// Parses INI file into keys by section, names and keys are lower case
+func parseINI(r io.Reader) (map[string]map[string]string, error) {
+	sections := make(map[string]map[string]string)
+	var keys map[string]string
+
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case line == "", line[0] == '#', line[0] == ';':
+			continue
+		case line[0] == '[' && line[len(line)-1] == ']':
+			name := strings.ToLower(strings.TrimSpace(line[1 : len(line)-1]))
+			keys = sections[name]
+			if keys == nil {
+				keys = make(map[string]string)
+				sections[name] = keys
+			}
+			continue
+		}
+
+		i := strings.IndexByte(line, '=')
+		if i < 0 || keys == nil {
+			return nil, fmt.Errorf("line %d: expected key = value", n)
+		}
+		keys[strings.ToLower(strings.TrimSpace(line[:i]))] = strings.TrimSpace(line[i+1:])
+	}
+	return sections, scanner.Err()
+}
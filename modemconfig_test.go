@@ -0,0 +1,125 @@
+package gsm
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testConfig = `
+# gammu-detect output with extra keys
+[gammu]
+device = /dev/ttyUSB0
+connection = at19200
+
+; second modem, keys in any case
+[ Gammu1 ]
+Device = /dev/ttyUSB2
+CONNECTION = at
+BaudRate = 9600
+DataBits = 7
+Parity = even
+StopBits = 2
+FlowControl = RTSCTS
+ReadTimeout = 500ms
+
+[gammu2]
+device = rfc2217://modem:2217
+parity = space
+
+[gammu3]
+name = no device
+`
+
+func writeConfig(t *testing.T, content string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "gammurc")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestReadModemConfig(t *testing.T) {
+	path := writeConfig(t, testConfig)
+
+	tests := []struct {
+		section int
+		config  ModemConfig
+	}{
+		{0, ModemConfig{Device: "/dev/ttyUSB0", Baud: 19200}},
+		{1, ModemConfig{Device: "/dev/ttyUSB2", Baud: 9600, DataBits: 7, Parity: 'E', StopBits: 2, RTSCTS: true, ReadTimeout: 500 * time.Millisecond}},
+		{2, ModemConfig{Device: "rfc2217://modem:2217", Parity: 'S'}},
+	}
+
+	for _, tt := range tests {
+		config, err := ReadModemConfig(path, tt.section)
+		if err != nil {
+			t.Errorf("section %d: %v", tt.section, err)
+			continue
+		}
+		if config != tt.config {
+			t.Errorf("section %d = %+v, want %+v", tt.section, config, tt.config)
+		}
+	}
+
+	for _, section := range []int{3, 4} {
+		if _, err := ReadModemConfig(path, section); err == nil {
+			t.Errorf("section %d read without error", section)
+		}
+	}
+	if _, err := ReadModemConfig(filepath.Join(t.TempDir(), "missing"), 0); !os.IsNotExist(err) {
+		t.Errorf("missing file err = %v", err)
+	}
+}
+
+func TestReadModemConfigInvalid(t *testing.T) {
+	tests := []struct {
+		name, keys string
+	}{
+		{"baudrate", "baudrate = fast"},
+		{"databits", "databits = eight"},
+		{"stopbits", "stopbits = 1.5"},
+		{"parity", "parity = x"},
+		{"mark parity", "parity = mark"},
+		{"space parity", "parity = S"},
+		{"flow control", "flowcontrol = xonxoff"},
+		{"read timeout", "readtimeout = 5"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := writeConfig(t, "[gammu]\ndevice = /dev/ttyUSB0\n"+tt.keys+"\n")
+			_, err := ReadModemConfig(path, 0)
+			if err == nil || !strings.Contains(err.Error(), "[gammu] ") {
+				t.Errorf("err = %v, want error naming the section", err)
+			}
+		})
+	}
+}
+
+func TestParseINI(t *testing.T) {
+	sections, err := parseINI(strings.NewReader("[A]\nkey = a = b\n[b]\n\n  # comment\n; comment\nX=\n[a]\nOther=1\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sections) != 2 {
+		t.Errorf("sections = %v", sections)
+	}
+	// repeated sections are merged, values keep their case and '='
+	if a := sections["a"]; len(a) != 2 || a["key"] != "a = b" || a["other"] != "1" {
+		t.Errorf("[a] = %v", a)
+	}
+	if v, ok := sections["b"]["x"]; !ok || v != "" {
+		t.Errorf("[b] = %v", sections["b"])
+	}
+
+	for _, input := range []string{"key = outside section\n", "[gammu]\nno value\n"} {
+		if _, err := parseINI(strings.NewReader(input)); err == nil || !strings.Contains(err.Error(), "line ") {
+			t.Errorf("parseINI(%q) err = %v", input, err)
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package gsm
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gemaalief/gsmgo/gsm7"
+	"github.com/gemaalief/gsmgo/pdu"
+)
+
+// Used by Modem.SendSMS for each part
+const sendTimeout = 60 * time.Second
+
+// Sends text as a single or multipart message in PDU mode, using UCS-2 if
+// the text does not fit the GSM default alphabet
+func (m *Modem) SendSMS(text, number string) error {
+	_, err := m.SendSMSContext(context.Background(), text, number)
+	return err
+}
+
+// Like SendSMS, waiting for the network reply to each part until ctx is done.
+// Options default to DefaultSendOptions.
+func (m *Modem) SendSMSContext(ctx context.Context, text, number string, opts ...SendOptions) (*SendResult, error) {
+	o := sendOptions(opts)
+
+	s := pdu.NewSubmit(number, text)
+	if o.Unicode {
+		s.Alphabet, s.Tables = pdu.AlphabetUCS2, gsm7.Tables{}
+	}
+	s.Class = o.class()
+	s.Validity = o.Validity
+	s.StatusReport = o.DeliveryReport
+	s.SMSC = o.SMSC
+
+	parts, err := s.Split(m.nextConcatRef())
+	if err != nil {
+		return nil, &Error{Code: CodeInvalidData, Op: "send sms", Msg: err.Error()}
+	}
+	return m.sendPDUs(ctx, number, parts...)
+}
+
+// Sends messages in PDU mode (AT+CMGF=0, AT+CMGS), returns message reference of each
+func (m *Modem) sendPDUs(ctx context.Context, number string, parts ...*pdu.Submit) (*SendResult, error) {
+	result := &SendResult{Number: number, Sent: time.Now()}
+
+	if _, err := m.Exec(ctx, "AT+CMGF=0"); err != nil {
+		return result, err
+	}
+
+	for _, s := range parts {
+		b, err := s.Encode()
+		if err != nil {
+			return result, &Error{Code: CodeInvalidData, Op: "send sms", Msg: err.Error()}
+		}
+
+		pctx, cancel := context.WithTimeout(ctx, sendTimeout)
+		cmd := fmt.Sprintf("AT+CMGS=%d", pdu.TPDULength(b))
+		resp, err := m.ExecPrompt(pctx, cmd, strings.ToUpper(hex.EncodeToString(b)))
+		cancel()
+		if err != nil {
+			return result, err
+		}
+
+		result.References = append(result.References, messageReference(resp.Lines))
+	}
+	return result, nil
+}
+
+// Returns concatenation reference for the next multipart message
+func (m *Modem) nextConcatRef() int {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.concatRef++
+	return int(m.concatRef)
+}
+
+// Returns reference from +CMGS: <mr>[,<scts>] response, -1 if missing
+func messageReference(lines []string) int {
+	for _, line := range lines {
+		if !strings.HasPrefix(line, "+CMGS:") {
+			continue
+		}
+		param := strings.TrimSpace(line[len("+CMGS:"):])
+		if i := strings.IndexByte(param, ','); i >= 0 {
+			param = param[:i]
+		}
+		if ref, err := strconv.Atoi(param); err == nil {
+			return ref
+		}
+	}
+	return -1
+}
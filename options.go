@@ -0,0 +1,53 @@
+package gsm
+
+import (
+	"time"
+)
+
+// Message class of sent messages, class 0 is sent with SendOptions.Flash
+type MessageClass int
+
+const (
+	ClassNone MessageClass = iota // no class, the recipient decides
+	Class1                        // stored in the phone
+	Class2                        // stored on the SIM
+	Class3                        // passed to terminal equipment
+)
+
+// Options for sending messages.
+//
+// The zero value sends a message without class and without delivery report,
+// DefaultSendOptions sets class 1 and requests a report.
+type SendOptions struct {
+	Class          MessageClass  // message class, ClassNone for none
+	Flash          bool          // flash message, sent as class 0 whatever Class is
+	Unicode        bool          // UCS-2 coding instead of the default alphabet
+	Validity       time.Duration // validity period, 0 for network default
+	DeliveryReport bool          // request status report, off in the zero value
+	SMSC           string        // service centre number, empty to read it from the phone
+}
+
+// Returns options used by SendSMS and SendLongSMS
+func DefaultSendOptions() SendOptions {
+	return SendOptions{Class: Class1, DeliveryReport: true}
+}
+
+// Returns effective message class 0-3, -1 for none
+func (o SendOptions) class() int {
+	if o.Flash {
+		return 0
+	}
+	switch o.Class {
+	case Class1, Class2, Class3:
+		return int(o.Class)
+	}
+	return -1
+}
+
+// Returns options passed to a variadic send method, defaults if none
+func sendOptions(opts []SendOptions) SendOptions {
+	if len(opts) > 0 {
+		return opts[0]
+	}
+	return DefaultSendOptions()
+}
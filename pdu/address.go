@@ -0,0 +1,113 @@
+package pdu
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/gemaalief/gsmgo/gsm7"
+)
+
+// Type of address octets
+const (
+	toaUnknown       = 0x81 // unknown type, ISDN numbering plan
+	toaInternational = 0x91 // international number, ISDN numbering plan
+	toaAlphanumeric  = 0xD0 // alphanumeric, GSM default alphabet
+
+	tonMask          = 0x70
+	tonInternational = 0x10
+	tonAlphanumeric  = 0x50
+)
+
+// Semi-octet digits, index is the semi-octet value
+const bcdDigits = "0123456789*#abc"
+
+// Returns type of address and swapped semi-octets of number, "+" prefix marks international numbers
+func encodeNumber(number string) (toa byte, bcd []byte, digits int, err error) {
+	toa = toaUnknown
+	if strings.HasPrefix(number, "+") {
+		toa = toaInternational
+		number = number[1:]
+	}
+	if number == "" {
+		return 0, nil, 0, fmt.Errorf("pdu: empty number")
+	}
+
+	bcd = make([]byte, (len(number)+1)/2)
+	for i := 0; i < len(number); i++ {
+		d := strings.IndexByte(bcdDigits, number[i])
+		if d < 0 {
+			return 0, nil, 0, fmt.Errorf("pdu: invalid character %q in number", number[i])
+		}
+		if i%2 == 0 {
+			bcd[i/2] = 0xF0 | byte(d)
+		} else {
+			bcd[i/2] = bcd[i/2]&0x0F | byte(d)<<4
+		}
+	}
+	return toa, bcd, len(number), nil
+}
+
+// Returns number from swapped semi-octets, decoding stops at filler
+func decodeNumber(toa byte, bcd []byte, digits int) string {
+	var b strings.Builder
+	if toa&tonMask == tonInternational {
+		b.WriteByte('+')
+	}
+	for i := 0; i < digits && i/2 < len(bcd); i++ {
+		d := bcd[i/2] & 0x0F
+		if i%2 == 1 {
+			d = bcd[i/2] >> 4
+		}
+		if d == 0x0F {
+			break
+		}
+		b.WriteByte(bcdDigits[d])
+	}
+	return b.String()
+}
+
+// Returns TP address field (TP-OA, TP-DA, TP-RA), length counts digits
+func encodeAddress(number string) ([]byte, error) {
+	toa, bcd, digits, err := encodeNumber(number)
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte{byte(digits), toa}, bcd...), nil
+}
+
+// Reads TP address field, alphanumeric senders are decoded as text
+func (r *reader) address() string {
+	digits := int(r.byte())
+	toa := r.byte()
+	bcd := r.bytes((digits + 1) / 2)
+	if r.err != nil {
+		return ""
+	}
+	if toa&tonMask == tonAlphanumeric {
+		return gsm7.Decode(gsm7.Unpack(bcd, 0, digits*4/7))
+	}
+	return decodeNumber(toa, bcd, digits)
+}
+
+// Returns service centre address field, length counts octets, empty number for the phone default
+func encodeSMSC(number string) ([]byte, error) {
+	if number == "" {
+		return []byte{0}, nil
+	}
+	toa, bcd, _, err := encodeNumber(number)
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte{byte(len(bcd) + 1), toa}, bcd...), nil
+}
+
+// Reads service centre address field
+func (r *reader) smsc() string {
+	n := int(r.byte())
+	if n == 0 {
+		return ""
+	}
+	toa := r.byte()
+	bcd := r.bytes(n - 1)
+	return decodeNumber(toa, bcd, 2*len(bcd))
+}
@@ -0,0 +1,136 @@
+package pdu
+
+import (
+	"time"
+
+	"github.com/gemaalief/gsmgo/gsm7"
+)
+
+// SMS-DELIVER, message received by the mobile station
+type Deliver struct {
+	SMSC         string
+	Number       string    // sender, text for alphanumeric senders
+	Timestamp    time.Time // service centre time stamp
+	MoreMessages bool      // service centre has more messages waiting
+	StatusReport bool      // status report will be returned to the sender
+	ReplyPath    bool
+	PID          byte
+
+	Alphabet Alphabet
+	Tables   gsm7.Tables // national language tables for the default alphabet
+	Class    int         // message class 0-3, -1 for none
+	UDH      UDH
+	Text     string // default alphabet and UCS-2 messages
+	Data     []byte // 8-bit messages
+}
+
+// Returns PDU with service centre address
+func (d *Deliver) Encode() ([]byte, error) {
+	b, err := encodeSMSC(d.SMSC)
+	if err != nil {
+		return nil, err
+	}
+
+	first := byte(TypeDeliver)
+	if !d.MoreMessages {
+		first |= flagMMS
+	}
+	if d.StatusReport {
+		first |= flagSRR
+	}
+	if len(header(d.UDH, d.Alphabet, d.Tables)) > 0 {
+		first |= flagUDHI
+	}
+	if d.ReplyPath {
+		first |= flagRP
+	}
+
+	oa, err := encodeAddress(d.Number)
+	if err != nil {
+		return nil, err
+	}
+	udl, ud, err := encodeUserData(d.UDH, d.Alphabet, d.Tables, d.Text, d.Data)
+	if err != nil {
+		return nil, err
+	}
+
+	b = append(b, first)
+	b = append(b, oa...)
+	b = append(b, d.PID, DCS(d.Alphabet, d.Class))
+	b = append(b, encodeTime(d.Timestamp)...)
+	b = append(b, udl)
+	return append(b, ud...), nil
+}
+
+func decodeDeliver(r *reader, smsc string) (*Deliver, error) {
+	d := &Deliver{SMSC: smsc}
+
+	first := r.byte()
+	d.MoreMessages = first&flagMMS == 0
+	d.StatusReport = first&flagSRR != 0
+	d.ReplyPath = first&flagRP != 0
+	d.Number = r.address()
+	d.PID = r.byte()
+	dcs := r.byte()
+	d.Timestamp = r.time()
+
+	d.Alphabet, d.Class, _ = ParseDCS(dcs)
+	d.UDH, d.Text, d.Data = r.userData(first&flagUDHI != 0, d.Alphabet)
+	d.Tables = d.UDH.Tables()
+	if r.err != nil {
+		return nil, r.err
+	}
+	return d, nil
+}
+
+// SMS-STATUS-REPORT, delivery status of a sent message
+type StatusReport struct {
+	SMSC             string
+	MessageReference byte      // TP-MR of the reported message
+	Number           string    // recipient of the reported message
+	Timestamp        time.Time // service centre time stamp of the reported message
+	Discharge        time.Time // time of delivery or last attempt
+	Status           byte      // TP-ST, below 0x20 if delivered
+	MoreMessages     bool
+}
+
+// Returns PDU with service centre address
+func (s *StatusReport) Encode() ([]byte, error) {
+	b, err := encodeSMSC(s.SMSC)
+	if err != nil {
+		return nil, err
+	}
+
+	first := byte(TypeStatusReport)
+	if !s.MoreMessages {
+		first |= flagMMS
+	}
+
+	ra, err := encodeAddress(s.Number)
+	if err != nil {
+		return nil, err
+	}
+
+	b = append(b, first, s.MessageReference)
+	b = append(b, ra...)
+	b = append(b, encodeTime(s.Timestamp)...)
+	b = append(b, encodeTime(s.Discharge)...)
+	return append(b, s.Status), nil
+}
+
+// Optional parameters after TP-ST are ignored
+func decodeStatusReport(r *reader, smsc string) (*StatusReport, error) {
+	s := &StatusReport{SMSC: smsc}
+
+	first := r.byte()
+	s.MoreMessages = first&flagMMS == 0
+	s.MessageReference = r.byte()
+	s.Number = r.address()
+	s.Timestamp = r.time()
+	s.Discharge = r.time()
+	s.Status = r.byte()
+	if r.err != nil {
+		return nil, r.err
+	}
+	return s, nil
+}
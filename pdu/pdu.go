@@ -0,0 +1,143 @@
+// Package pdu encodes and decodes SMS transfer protocol data units
+// (3GPP TS 23.040) as used by AT modems in PDU mode (AT+CMGF=0).
+//
+// PDUs handled by this package start with the service centre address,
+// as sent by AT+CMGS and listed by AT+CMGL, AT+CMGR, +CMT and +CDS.
+package pdu
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Message type indicator (TP-MTI) as seen by the mobile station
+type Type byte
+
+const (
+	TypeDeliver      Type = 0x00
+	TypeSubmit       Type = 0x01
+	TypeStatusReport Type = 0x02
+)
+
+func (t Type) String() string {
+	switch t {
+	case TypeDeliver:
+		return "SMS-DELIVER"
+	case TypeSubmit:
+		return "SMS-SUBMIT"
+	case TypeStatusReport:
+		return "SMS-STATUS-REPORT"
+	}
+	return "reserved"
+}
+
+// First octet flags
+const (
+	flagMMS  = 0x04 // TP-MMS, set if no more messages are waiting
+	flagRD   = 0x04 // TP-RD, reject duplicates
+	flagSRR  = 0x20 // TP-SRR, TP-SRI and TP-SRQ
+	flagUDHI = 0x40 // user data starts with header
+	flagRP   = 0x80 // reply path
+
+	vpfNone     = 0x00
+	vpfEnhanced = 0x08
+	vpfRelative = 0x10
+	vpfAbsolute = 0x18
+)
+
+// Maximum user data length in octets
+const MaxUserData = 140
+
+// Maximum number of concatenated parts, the count is one octet of the header
+const MaxParts = 255
+
+// ErrShort is returned when PDU ends before all fields are read
+var ErrShort = errors.New("pdu: data too short")
+
+// Decodes PDU starting with service centre address.
+//
+// Returns *Deliver, *Submit or *StatusReport.
+func Decode(b []byte) (interface{}, error) {
+	r := &reader{b: b}
+	smsc := r.smsc()
+	if r.err != nil {
+		return nil, r.err
+	}
+	if r.i >= len(b) {
+		return nil, ErrShort
+	}
+
+	var m interface{}
+	var err error
+	switch Type(b[r.i] & 0x03) {
+	case TypeDeliver:
+		m, err = decodeDeliver(r, smsc)
+	case TypeSubmit:
+		m, err = decodeSubmit(r, smsc)
+	case TypeStatusReport:
+		m, err = decodeStatusReport(r, smsc)
+	default:
+		err = fmt.Errorf("pdu: reserved message type %d", b[r.i]&0x03)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// Decodes PDU in hex, as listed by the modem
+func DecodeHex(s string) (interface{}, error) {
+	b, err := hex.DecodeString(strings.TrimSpace(s))
+	if err != nil {
+		return nil, fmt.Errorf("pdu: %v", err)
+	}
+	return Decode(b)
+}
+
+// Returns TPDU length of pdu, the length AT+CMGS expects, service centre address is not counted
+func TPDULength(pdu []byte) int {
+	if len(pdu) == 0 {
+		return 0
+	}
+	return len(pdu) - 1 - int(pdu[0])
+}
+
+// Reads PDU fields, the first error is kept and later reads return zero values
+type reader struct {
+	b   []byte
+	i   int
+	err error
+}
+
+func (r *reader) bytes(n int) []byte {
+	if r.err != nil {
+		return nil
+	}
+	if n < 0 || r.i+n > len(r.b) {
+		r.err = ErrShort
+		return nil
+	}
+	b := r.b[r.i : r.i+n]
+	r.i += n
+	return b
+}
+
+func (r *reader) byte() byte {
+	b := r.bytes(1)
+	if b == nil {
+		return 0
+	}
+	return b[0]
+}
+
+// Returns remaining bytes
+func (r *reader) rest() []byte {
+	if r.err != nil {
+		return nil
+	}
+	b := r.b[r.i:]
+	r.i = len(r.b)
+	return b
+}
@@ -0,0 +1,217 @@
+package pdu
+
+import (
+	"encoding/hex"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gemaalief/gsmgo/gsm7"
+)
+
+const (
+	// SMS-DELIVER of "hellohello" from 27838890001, national number
+	deliverFixture = "07917283010010F5040BC87238880900F10000993092516195800AE8329BFD4697D9EC37"
+	// SMS-SUBMIT of "hellohello" to +46708251358, validity 4 days
+	submitFixture = "0011000B916407281553F80000AA0AE8329BFD4697D9EC37"
+	// SMS-STATUS-REPORT for reference 42, delivered
+	statusFixture = "07917283010010F5062A0B917238880900F1" + "99309251619580" + "99309251619580" + "00"
+)
+
+func TestDecodeDeliver(t *testing.T) {
+	m, err := DecodeHex(deliverFixture)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d, ok := m.(*Deliver)
+	if !ok {
+		t.Fatalf("got %T, want *Deliver", m)
+	}
+
+	if d.SMSC != "+27381000015" {
+		t.Errorf("SMSC = %q", d.SMSC)
+	}
+	if d.Number != "27838890001" {
+		t.Errorf("Number = %q", d.Number)
+	}
+	if d.Text != "hellohello" {
+		t.Errorf("Text = %q", d.Text)
+	}
+	if d.Alphabet != AlphabetDefault || d.Class != -1 {
+		t.Errorf("Alphabet, Class = %v, %d", d.Alphabet, d.Class)
+	}
+	if d.MoreMessages {
+		t.Error("MoreMessages set")
+	}
+
+	want := time.Date(1999, 3, 29, 15, 16, 59, 0, time.FixedZone("", 2*60*60))
+	if !d.Timestamp.Equal(want) {
+		t.Errorf("Timestamp = %v, want %v", d.Timestamp, want)
+	}
+	if _, offset := d.Timestamp.Zone(); offset != 2*60*60 {
+		t.Errorf("zone offset = %d", offset)
+	}
+}
+
+func TestDecodeSubmit(t *testing.T) {
+	m, err := DecodeHex(submitFixture)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, ok := m.(*Submit)
+	if !ok {
+		t.Fatalf("got %T, want *Submit", m)
+	}
+
+	if s.SMSC != "" {
+		t.Errorf("SMSC = %q", s.SMSC)
+	}
+	if s.Number != "+46708251358" {
+		t.Errorf("Number = %q", s.Number)
+	}
+	if s.Text != "hellohello" {
+		t.Errorf("Text = %q", s.Text)
+	}
+	if s.Validity != 4*24*time.Hour {
+		t.Errorf("Validity = %v", s.Validity)
+	}
+}
+
+func TestDecodeStatusReport(t *testing.T) {
+	m, err := DecodeHex(statusFixture)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, ok := m.(*StatusReport)
+	if !ok {
+		t.Fatalf("got %T, want *StatusReport", m)
+	}
+
+	if s.MessageReference != 42 {
+		t.Errorf("MessageReference = %d", s.MessageReference)
+	}
+	if s.Number != "+27838890001" {
+		t.Errorf("Number = %q", s.Number)
+	}
+	if s.Status != 0 {
+		t.Errorf("Status = %#x", s.Status)
+	}
+	if s.Timestamp.Year() != 1999 || s.Discharge.Minute() != 16 {
+		t.Errorf("Timestamp, Discharge = %v, %v", s.Timestamp, s.Discharge)
+	}
+
+	b, err := s.Encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.ToUpper(hex.EncodeToString(b)); got != statusFixture {
+		t.Errorf("Encode = %s, want %s", got, statusFixture)
+	}
+}
+
+func TestDecodeAlphanumericSender(t *testing.T) {
+	// "Test" as 4 packed septets, length counts semi-octets
+	d := &Deliver{Number: "+1", Class: -1, Text: "x"}
+	b, err := d.Encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	b = append(b[:2], append([]byte{0x07, toaAlphanumeric, 0xD4, 0xF2, 0x9C, 0x0E}, b[5:]...)...)
+
+	m, err := Decode(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := m.(*Deliver).Number; got != "Test" {
+		t.Errorf("Number = %q, want Test", got)
+	}
+}
+
+func TestDecodeTruncated(t *testing.T) {
+	for _, fixture := range []string{deliverFixture, submitFixture, statusFixture} {
+		b, _ := hex.DecodeString(fixture)
+		for n := 0; n < len(b); n++ {
+			if _, err := Decode(b[:n]); err == nil {
+				t.Errorf("Decode(%X) succeeded", b[:n])
+			}
+		}
+	}
+}
+
+func TestDecodeMalformed(t *testing.T) {
+	tests := []struct {
+		name string
+		pdu  string
+	}{
+		{"reserved type", "0003"},
+		{"not hex", "07917283010010F5ZZ"},
+		{"smsc too long", "0F91"},
+		{"udh longer than udl", "0044" + "0B916407281553F8" + "0000" + "99309251619580" + "01" + "050003010201" + "41"},
+		{"udh longer than ud", "0044" + "0B916407281553F8" + "0000" + "99309251619580" + "0A" + "0A0003010201"},
+		{"ucs2 udh longer than udl", "0044" + "0B916407281553F8" + "0008" + "99309251619580" + "02" + "0500030102010041"},
+		{"8bit udh longer than udl", "0044" + "0B916407281553F8" + "0004" + "99309251619580" + "03" + "05000301020141"},
+		{"ucs2 udl longer than ud", "0004" + "0B916407281553F8" + "0008" + "99309251619580" + "08" + "00410042"},
+		{"udl longer than ud", "0004" + "0B916407281553F8" + "0000" + "99309251619580" + "A0" + "E8329BFD4697D9EC37"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, err := DecodeHex(tt.pdu)
+			if err == nil {
+				t.Errorf("DecodeHex = %#v, want error", m)
+			}
+		})
+	}
+}
+
+func TestDecodeUDHLongerThanUDL(t *testing.T) {
+	_, err := DecodeHex("0044" + "0B916407281553F8" + "0000" + "99309251619580" + "01" + "050003010201" + "41")
+	if err == nil || errors.Is(err, ErrShort) {
+		t.Errorf("err = %v, want invalid user data", err)
+	}
+}
+
+func TestDecodeUnsupportedLanguage(t *testing.T) {
+	// single shift element for Hindi, text "a"
+	_, err := DecodeHex("0044" + "0B916407281553F8" + "0000" + "99309251619580" + "06" + "03240106" + "0803")
+	var ue *gsm7.UnsupportedError
+	if !errors.As(err, &ue) || ue.Language != gsm7.Hindi {
+		t.Errorf("err = %v, want unsupported hindi", err)
+	}
+
+	d := &Deliver{Number: "+1", Class: -1, Tables: gsm7.Tables{Single: gsm7.Hindi}, Text: "a"}
+	if _, err := d.Encode(); !errors.As(err, &ue) {
+		t.Errorf("Encode err = %v, want unsupported language", err)
+	}
+}
+
+func TestTPDULength(t *testing.T) {
+	b, _ := hex.DecodeString(deliverFixture)
+	if n := TPDULength(b); n != len(b)-8 {
+		t.Errorf("TPDULength = %d, want %d", n, len(b)-8)
+	}
+	if n := TPDULength(nil); n != 0 {
+		t.Errorf("TPDULength(nil) = %d", n)
+	}
+}
+
+func FuzzDecode(f *testing.F) {
+	for _, fixture := range []string{deliverFixture, submitFixture, statusFixture} {
+		b, _ := hex.DecodeString(fixture)
+		f.Add(b)
+	}
+	s := NewSubmit("+123", strings.Repeat("long text ", 40))
+	parts, _ := s.Split(7)
+	for _, p := range parts {
+		b, _ := p.Encode()
+		f.Add(b)
+	}
+
+	f.Fuzz(func(t *testing.T, b []byte) {
+		m, err := Decode(b)
+		if err == nil && m == nil {
+			t.Error("nil message without error")
+		}
+	})
+}
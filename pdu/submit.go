@@ -0,0 +1,192 @@
+package pdu
+
+import (
+	"fmt"
+	"time"
+	"unicode/utf16"
+
+	"github.com/gemaalief/gsmgo/gsm7"
+)
+
+// SMS-SUBMIT, message sent by the mobile station
+type Submit struct {
+	SMSC             string // service centre number, empty for the phone default
+	Number           string // recipient, "+" prefix for international numbers
+	MessageReference byte   // TP-MR, modems usually assign it
+	RejectDuplicates bool
+	StatusReport     bool          // request status report
+	Validity         time.Duration // relative validity period, 0 for none
+	PID              byte          // protocol identifier
+
+	Alphabet Alphabet
+	Tables   gsm7.Tables // national language tables for the default alphabet
+	Class    int         // message class 0-3, -1 for none
+	UDH      UDH
+	Text     string // default alphabet and UCS-2 messages
+	Data     []byte // 8-bit messages
+}
+
+// Returns text message to number.
+//
+// The default alphabet is used if text fits it or the tables of one of
+// languages, UCS-2 otherwise.
+func NewSubmit(number, text string, languages ...gsm7.Language) *Submit {
+	s := &Submit{Number: number, Text: text, Class: -1}
+	if t, ok := gsm7.Select(text, languages...); ok {
+		s.Tables = t
+	} else {
+		s.Alphabet = AlphabetUCS2
+	}
+	return s
+}
+
+// Returns PDU with service centre address
+func (s *Submit) Encode() ([]byte, error) {
+	b, err := encodeSMSC(s.SMSC)
+	if err != nil {
+		return nil, err
+	}
+
+	first := byte(TypeSubmit)
+	if s.RejectDuplicates {
+		first |= flagRD
+	}
+	if s.Validity > 0 {
+		first |= vpfRelative
+	}
+	if s.StatusReport {
+		first |= flagSRR
+	}
+	if len(header(s.UDH, s.Alphabet, s.Tables)) > 0 {
+		first |= flagUDHI
+	}
+
+	da, err := encodeAddress(s.Number)
+	if err != nil {
+		return nil, err
+	}
+	udl, ud, err := encodeUserData(s.UDH, s.Alphabet, s.Tables, s.Text, s.Data)
+	if err != nil {
+		return nil, err
+	}
+
+	b = append(b, first, s.MessageReference)
+	b = append(b, da...)
+	b = append(b, s.PID, DCS(s.Alphabet, s.Class))
+	if s.Validity > 0 {
+		b = append(b, Validity(s.Validity))
+	}
+	b = append(b, udl)
+	return append(b, ud...), nil
+}
+
+// Splits message into concatenated parts with reference ref.
+//
+// Returns the message itself if it fits. Characters are never split across parts.
+// Fails if more than MaxParts parts are needed.
+func (s *Submit) Split(ref int) ([]*Submit, error) {
+	size := func(h UDH) int {
+		n := len(header(h, s.Alphabet, s.Tables).Bytes())
+		if s.Alphabet == AlphabetDefault {
+			return (MaxUserData*8 - n*8 - fillBits(n)) / 7
+		}
+		return MaxUserData - n
+	}
+
+	if s.length() <= size(s.UDH) {
+		return []*Submit{s}, nil
+	}
+
+	// reference is final later, only its size matters here
+	limit := size(append(UDH{Concat(ref, 0, 0)}, s.UDH...))
+
+	var chunks []string
+	var data [][]byte
+	if s.Alphabet == Alphabet8bit {
+		for b := s.Data; len(b) > 0; {
+			n := limit
+			if n > len(b) {
+				n = len(b)
+			}
+			data = append(data, b[:n])
+			b = b[n:]
+		}
+	} else {
+		used, start := 0, 0
+		for i, r := range s.Text {
+			n := s.runeLength(r)
+			if used+n > limit {
+				chunks = append(chunks, s.Text[start:i])
+				start, used = i, 0
+			}
+			used += n
+		}
+		chunks = append(chunks, s.Text[start:])
+	}
+
+	parts := len(chunks) + len(data)
+	if parts > MaxParts {
+		return nil, fmt.Errorf("pdu: message too long, %d parts", parts)
+	}
+	out := make([]*Submit, parts)
+	for i := range out {
+		p := *s
+		p.UDH = append(UDH{Concat(ref, parts, i+1)}, s.UDH...)
+		if s.Alphabet == Alphabet8bit {
+			p.Data = data[i]
+		} else {
+			p.Text = chunks[i]
+		}
+		out[i] = &p
+	}
+	return out, nil
+}
+
+// Returns user data length without header, septets or octets
+func (s *Submit) length() int {
+	if s.Alphabet == Alphabet8bit {
+		return len(s.Data)
+	}
+	n := 0
+	for _, r := range s.Text {
+		n += s.runeLength(r)
+	}
+	return n
+}
+
+func (s *Submit) runeLength(r rune) int {
+	if s.Alphabet == AlphabetUCS2 {
+		return 2 * len(utf16.Encode([]rune{r}))
+	}
+	if n := s.Tables.Septets(r); n > 0 {
+		return n
+	}
+	return 1
+}
+
+func decodeSubmit(r *reader, smsc string) (*Submit, error) {
+	s := &Submit{SMSC: smsc}
+
+	first := r.byte()
+	s.RejectDuplicates = first&flagRD != 0
+	s.StatusReport = first&flagSRR != 0
+	s.MessageReference = r.byte()
+	s.Number = r.address()
+	s.PID = r.byte()
+	dcs := r.byte()
+
+	switch first & vpfAbsolute {
+	case vpfRelative:
+		s.Validity = ValidityDuration(r.byte())
+	case vpfEnhanced, vpfAbsolute:
+		r.bytes(7)
+	}
+
+	s.Alphabet, s.Class, _ = ParseDCS(dcs)
+	s.UDH, s.Text, s.Data = r.userData(first&flagUDHI != 0, s.Alphabet)
+	s.Tables = s.UDH.Tables()
+	if r.err != nil {
+		return nil, r.err
+	}
+	return s, nil
+}
@@ -0,0 +1,220 @@
+package pdu
+
+import (
+	"bytes"
+	"encoding/hex"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gemaalief/gsmgo/gsm7"
+)
+
+func TestSubmitEncode(t *testing.T) {
+	s := NewSubmit("+46708251358", "hellohello")
+	s.Validity = 4 * 24 * time.Hour
+
+	b, err := s.Encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.ToUpper(hex.EncodeToString(b)); got != submitFixture {
+		t.Errorf("Encode = %s, want %s", got, submitFixture)
+	}
+}
+
+func TestSubmitRoundTrip(t *testing.T) {
+	tests := []struct {
+		name string
+		s    *Submit
+	}{
+		{"default", &Submit{Number: "+123456789", Class: -1, Text: "Hello {world} €"}},
+		{"ucs2", &Submit{Number: "123", Class: 1, Alphabet: AlphabetUCS2, Text: "Здраво 😀"}},
+		{"8bit ports", &Submit{Number: "+1", Class: -1, Alphabet: Alphabet8bit, UDH: UDH{Ports(0, 2948)}, Data: []byte{0, 1, 0xFF}}},
+		{"flash report", &Submit{Number: "+1", Class: 0, StatusReport: true, SMSC: "+3816", Text: "flash"}},
+		{"turkish", &Submit{Number: "+90", Class: -1, Tables: gsm7.Tables{Single: gsm7.Turkish, Locking: gsm7.Turkish}, Text: "Işık ğ"}},
+		{"validity", &Submit{Number: "+1", Class: 2, Validity: 12 * time.Hour, RejectDuplicates: true, Text: "x"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, err := tt.s.Encode()
+			if err != nil {
+				t.Fatal(err)
+			}
+			m, err := Decode(b)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, ok := m.(*Submit)
+			if !ok {
+				t.Fatalf("got %T, want *Submit", m)
+			}
+
+			want := tt.s
+			if got.Number != want.Number || got.SMSC != want.SMSC || got.Text != want.Text ||
+				!bytes.Equal(got.Data, want.Data) || got.Class != want.Class ||
+				got.Alphabet != want.Alphabet || got.Tables != want.Tables ||
+				got.StatusReport != want.StatusReport || got.RejectDuplicates != want.RejectDuplicates ||
+				got.Validity != want.Validity {
+				t.Errorf("got %+v\nwant %+v", got, want)
+			}
+			if src, dst, ok := want.UDH.Ports(); ok {
+				if gs, gd, _ := got.UDH.Ports(); gs != src || gd != dst {
+					t.Errorf("Ports = %d, %d, want %d, %d", gs, gd, src, dst)
+				}
+			}
+		})
+	}
+}
+
+func TestDeliverRoundTrip(t *testing.T) {
+	ts := time.Date(2024, 2, 29, 23, 59, 1, 0, time.FixedZone("", -(3*60+30)*60))
+	d := &Deliver{SMSC: "+381", Number: "+38164", Timestamp: ts, MoreMessages: true, Class: 1, Text: "ok"}
+
+	b, err := d.Encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := Decode(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := m.(*Deliver)
+	if got.Number != d.Number || got.Text != d.Text || got.Class != 1 || !got.MoreMessages {
+		t.Errorf("got %+v", got)
+	}
+	if !got.Timestamp.Equal(ts) {
+		t.Errorf("Timestamp = %v, want %v", got.Timestamp, ts)
+	}
+}
+
+func TestSplit(t *testing.T) {
+	tests := []struct {
+		name  string
+		s     *Submit
+		parts int
+	}{
+		{"single default", NewSubmit("+1", strings.Repeat("a", 160)), 1},
+		{"two default", NewSubmit("+1", strings.Repeat("a", 161)), 2},
+		{"escape not split", NewSubmit("+1", strings.Repeat("a", 152)+"€"), 1},
+		{"three default", NewSubmit("+1", strings.Repeat("a", 153*2+1)), 3},
+		{"single ucs2", NewSubmit("+1", strings.Repeat("ж", 70)), 1},
+		{"two ucs2", NewSubmit("+1", strings.Repeat("ж", 71)), 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parts, err := tt.s.Split(0x1234)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(parts) != tt.parts {
+				t.Fatalf("got %d parts, want %d", len(parts), tt.parts)
+			}
+
+			var text strings.Builder
+			for i, p := range parts {
+				b, err := p.Encode()
+				if err != nil {
+					t.Fatalf("part %d: %v", i+1, err)
+				}
+				m, err := Decode(b)
+				if err != nil {
+					t.Fatalf("part %d: %v", i+1, err)
+				}
+				got := m.(*Submit)
+				text.WriteString(got.Text)
+
+				if tt.parts == 1 {
+					continue
+				}
+				ref, n, part, ok := got.UDH.Concat()
+				if !ok || ref != 0x1234 || n != tt.parts || part != i+1 {
+					t.Errorf("part %d: Concat = %d, %d, %d, %v", i+1, ref, n, part, ok)
+				}
+			}
+			if text.String() != tt.s.Text {
+				t.Errorf("joined text differs")
+			}
+		})
+	}
+}
+
+func TestSplitTooLong(t *testing.T) {
+	if parts, err := NewSubmit("+1", strings.Repeat("a", 153*255)).Split(1); err != nil || len(parts) != 255 {
+		t.Errorf("Split of 255 parts = %d parts, %v", len(parts), err)
+	}
+	if _, err := NewSubmit("+1", strings.Repeat("a", 153*255+1)).Split(1); err == nil {
+		t.Error("Split of 256 parts succeeded")
+	}
+	s := &Submit{Number: "+1", Class: -1, Alphabet: Alphabet8bit, Data: make([]byte, 134*300)}
+	if _, err := s.Split(1); err == nil {
+		t.Error("Split of 300 data parts succeeded")
+	}
+}
+
+func TestEncodeTooLong(t *testing.T) {
+	s := NewSubmit("+1", strings.Repeat("a", 161))
+	if _, err := s.Encode(); err == nil {
+		t.Error("Encode of 161 septets succeeded")
+	}
+	s = &Submit{Number: "+1", Class: -1, Alphabet: Alphabet8bit, Data: make([]byte, 141)}
+	if _, err := s.Encode(); err == nil {
+		t.Error("Encode of 141 octets succeeded")
+	}
+	s = NewSubmit("12a-", "x")
+	if _, err := s.Encode(); err == nil {
+		t.Error("Encode with invalid number succeeded")
+	}
+}
+
+func TestParseDCS(t *testing.T) {
+	tests := []struct {
+		dcs      byte
+		alphabet Alphabet
+		class    int
+	}{
+		{0x00, AlphabetDefault, -1},
+		{0x08, AlphabetUCS2, -1},
+		{0x04, Alphabet8bit, -1},
+		{0x10, AlphabetDefault, 0},
+		{0x19, AlphabetUCS2, 1},
+		{0xF5, Alphabet8bit, 1},
+		{0xF2, AlphabetDefault, 2},
+		{0xC8, AlphabetDefault, -1},
+		{0xE0, AlphabetUCS2, -1},
+	}
+
+	for _, tt := range tests {
+		alphabet, class, _ := ParseDCS(tt.dcs)
+		if alphabet != tt.alphabet || class != tt.class {
+			t.Errorf("ParseDCS(%#x) = %v, %d, want %v, %d", tt.dcs, alphabet, class, tt.alphabet, tt.class)
+		}
+		if tt.dcs < 0x40 {
+			if got := DCS(alphabet, class); got != tt.dcs {
+				t.Errorf("DCS(%v, %d) = %#x, want %#x", alphabet, class, got, tt.dcs)
+			}
+		}
+	}
+}
+
+func TestParseUDH(t *testing.T) {
+	h := UDH{Concat(300, 3, 2), Ports(16000, 2948), IE{IESingle, []byte{1}}}
+	b := h.Bytes()
+	got := parseUDH(b[1:])
+	if !bytes.Equal(got.Bytes(), b) {
+		t.Errorf("parseUDH = %X, want %X", got.Bytes(), b)
+	}
+	if ref, parts, part, _ := got.Concat(); ref != 300 || parts != 3 || part != 2 {
+		t.Errorf("Concat = %d, %d, %d", ref, parts, part)
+	}
+	if got.Tables() != (gsm7.Tables{Single: gsm7.Turkish}) {
+		t.Errorf("Tables = %+v", got.Tables())
+	}
+
+	// truncated trailing element is dropped
+	if got := parseUDH([]byte{0x00, 0x03, 1, 2, 3, 0x04, 0x02, 1}); len(got) != 1 {
+		t.Errorf("parseUDH kept %d elements, want 1", len(got))
+	}
+}
@@ -0,0 +1,98 @@
+package pdu
+
+import (
+	"time"
+)
+
+// Returns service centre time stamp (TP-SCTS), see 3GPP TS 23.040 9.2.3.11
+func encodeTime(t time.Time) []byte {
+	_, offset := t.Zone()
+	quarters := offset / (15 * 60)
+	sign := byte(0)
+	if quarters < 0 {
+		quarters = -quarters
+		sign = 0x08
+	}
+	return []byte{
+		swapped(t.Year() % 100),
+		swapped(int(t.Month())),
+		swapped(t.Day()),
+		swapped(t.Hour()),
+		swapped(t.Minute()),
+		swapped(t.Second()),
+		swapped(quarters) | sign,
+	}
+}
+
+// Reads service centre time stamp, time zone is kept as fixed offset
+func (r *reader) time() time.Time {
+	b := r.bytes(7)
+	if r.err != nil {
+		return time.Time{}
+	}
+
+	quarters := unswapped(b[6] & 0xF7)
+	if b[6]&0x08 != 0 {
+		quarters = -quarters
+	}
+	loc := time.FixedZone("", quarters*15*60)
+
+	// two digit year, stamps before 1970 do not occur
+	year := 2000 + unswapped(b[0])
+	if year >= 2070 {
+		year -= 100
+	}
+
+	return time.Date(year, time.Month(unswapped(b[1])), unswapped(b[2]),
+		unswapped(b[3]), unswapped(b[4]), unswapped(b[5]), 0, loc)
+}
+
+// Returns two digit value as swapped semi-octets
+func swapped(v int) byte {
+	return byte(v%10)<<4 | byte(v/10%10)
+}
+
+// Returns value of swapped semi-octets
+func unswapped(b byte) int {
+	return int(b&0x0F)*10 + int(b>>4)
+}
+
+// Returns relative validity period octet (TP-VP) covering d, see 3GPP TS 23.040 9.2.3.12.1
+func Validity(d time.Duration) byte {
+	const day = 24 * time.Hour
+	switch {
+	case d <= 12*time.Hour:
+		return byte(ceil(d, 5*time.Minute) - 1)
+	case d <= day:
+		return byte(143 + ceil(d-12*time.Hour, 30*time.Minute))
+	case d <= 30*day:
+		return byte(166 + ceil(d, day))
+	case d <= 63*7*day:
+		return byte(192 + ceil(d, 7*day))
+	}
+	return 255
+}
+
+// Returns duration of relative validity period octet
+func ValidityDuration(vp byte) time.Duration {
+	const day = 24 * time.Hour
+	v := time.Duration(vp)
+	switch {
+	case vp <= 143:
+		return (v + 1) * 5 * time.Minute
+	case vp <= 167:
+		return 12*time.Hour + (v-143)*30*time.Minute
+	case vp <= 196:
+		return (v - 166) * day
+	}
+	return (v - 192) * 7 * day
+}
+
+// Returns d divided by unit, rounded up, at least 1
+func ceil(d, unit time.Duration) int {
+	n := int((d + unit - 1) / unit)
+	if n < 1 {
+		return 1
+	}
+	return n
+}
@@ -0,0 +1,57 @@
+package pdu
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTime(t *testing.T) {
+	tests := []time.Time{
+		time.Date(1999, 3, 29, 15, 16, 59, 0, time.FixedZone("", 2*60*60)),
+		time.Date(2024, 12, 1, 0, 0, 0, 0, time.FixedZone("", -5*60*60)),
+		time.Date(2069, 1, 2, 3, 4, 5, 0, time.FixedZone("", 5*60*60+45*60)),
+	}
+
+	for _, want := range tests {
+		r := &reader{b: encodeTime(want)}
+		got := r.time()
+		if r.err != nil {
+			t.Fatal(r.err)
+		}
+		if !got.Equal(want) {
+			t.Errorf("time(encodeTime(%v)) = %v", want, got)
+		}
+		_, offset := got.Zone()
+		if _, w := want.Zone(); offset != w {
+			t.Errorf("offset of %v = %d, want %d", want, offset, w)
+		}
+	}
+}
+
+func TestValidity(t *testing.T) {
+	tests := []struct {
+		d    time.Duration
+		vp   byte
+		back time.Duration
+	}{
+		{time.Minute, 0, 5 * time.Minute},
+		{time.Hour, 11, time.Hour},
+		{12 * time.Hour, 143, 12 * time.Hour},
+		{13 * time.Hour, 145, 13 * time.Hour},
+		{24 * time.Hour, 167, 24 * time.Hour},
+		{4 * 24 * time.Hour, 170, 4 * 24 * time.Hour},
+		{30 * 24 * time.Hour, 196, 30 * 24 * time.Hour},
+		{5 * 7 * 24 * time.Hour, 197, 5 * 7 * 24 * time.Hour},
+		{63 * 7 * 24 * time.Hour, 255, 63 * 7 * 24 * time.Hour},
+		{100 * 7 * 24 * time.Hour, 255, 63 * 7 * 24 * time.Hour},
+	}
+
+	for _, tt := range tests {
+		if vp := Validity(tt.d); vp != tt.vp {
+			t.Errorf("Validity(%v) = %d, want %d", tt.d, vp, tt.vp)
+		}
+		if d := ValidityDuration(tt.vp); d != tt.back {
+			t.Errorf("ValidityDuration(%d) = %v, want %v", tt.vp, d, tt.back)
+		}
+	}
+}
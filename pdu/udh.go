@@ -0,0 +1,128 @@
+package pdu
+
+import (
+	"github.com/gemaalief/gsmgo/gsm7"
+)
+
+// Information element identifiers, see 3GPP TS 23.040 9.2.3.24
+const (
+	IEConcat8  = 0x00 // concatenated message, 8-bit reference
+	IEPorts8   = 0x04 // application port addressing, 8-bit ports
+	IEPorts16  = 0x05 // application port addressing, 16-bit ports
+	IEConcat16 = 0x08 // concatenated message, 16-bit reference
+	IESingle   = 0x24 // national language single shift
+	IELocking  = 0x25 // national language locking shift
+)
+
+// Information element of user data header
+type IE struct {
+	ID   byte
+	Data []byte
+}
+
+// User data header
+type UDH []IE
+
+// Returns concatenation element, 16-bit reference is used if ref does not fit in one octet
+func Concat(ref, parts, part int) IE {
+	if ref > 0xFF {
+		return IE{IEConcat16, []byte{byte(ref >> 8), byte(ref), byte(parts), byte(part)}}
+	}
+	return IE{IEConcat8, []byte{byte(ref), byte(parts), byte(part)}}
+}
+
+// Returns port addressing element, 8-bit ports are used if both fit
+func Ports(src, dst int) IE {
+	if src <= 0xFF && dst <= 0xFF {
+		return IE{IEPorts8, []byte{byte(dst), byte(src)}}
+	}
+	return IE{IEPorts16, []byte{byte(dst >> 8), byte(dst), byte(src >> 8), byte(src)}}
+}
+
+// Returns concatenation reference, number of parts and part number starting at 1
+func (h UDH) Concat() (ref, parts, part int, ok bool) {
+	for _, ie := range h {
+		switch {
+		case ie.ID == IEConcat8 && len(ie.Data) == 3:
+			return int(ie.Data[0]), int(ie.Data[1]), int(ie.Data[2]), true
+		case ie.ID == IEConcat16 && len(ie.Data) == 4:
+			return int(ie.Data[0])<<8 | int(ie.Data[1]), int(ie.Data[2]), int(ie.Data[3]), true
+		}
+	}
+	return 0, 0, 0, false
+}
+
+// Returns source and destination port
+func (h UDH) Ports() (src, dst int, ok bool) {
+	for _, ie := range h {
+		switch {
+		case ie.ID == IEPorts8 && len(ie.Data) == 2:
+			return int(ie.Data[1]), int(ie.Data[0]), true
+		case ie.ID == IEPorts16 && len(ie.Data) == 4:
+			return int(ie.Data[2])<<8 | int(ie.Data[3]), int(ie.Data[0])<<8 | int(ie.Data[1]), true
+		}
+	}
+	return 0, 0, false
+}
+
+// Returns national language tables selected by shift elements
+func (h UDH) Tables() gsm7.Tables {
+	var t gsm7.Tables
+	for _, ie := range h {
+		switch {
+		case ie.ID == IESingle && len(ie.Data) == 1:
+			t.Single = gsm7.Language(ie.Data[0])
+		case ie.ID == IELocking && len(ie.Data) == 1:
+			t.Locking = gsm7.Language(ie.Data[0])
+		}
+	}
+	return t
+}
+
+// Returns header with shift elements for national language tables added if missing
+func (h UDH) withTables(t gsm7.Tables) UDH {
+	if t == h.Tables() {
+		return h
+	}
+	out := UDH{}
+	for _, ie := range h {
+		if ie.ID != IESingle && ie.ID != IELocking {
+			out = append(out, ie)
+		}
+	}
+	if t.Single != gsm7.Default {
+		out = append(out, IE{IESingle, []byte{byte(t.Single)}})
+	}
+	if t.Locking != gsm7.Default {
+		out = append(out, IE{IELocking, []byte{byte(t.Locking)}})
+	}
+	return out
+}
+
+// Returns header with length octet, nil if there are no elements
+func (h UDH) Bytes() []byte {
+	if len(h) == 0 {
+		return nil
+	}
+	b := []byte{0}
+	for _, ie := range h {
+		b = append(b, ie.ID, byte(len(ie.Data)))
+		b = append(b, ie.Data...)
+	}
+	b[0] = byte(len(b) - 1)
+	return b
+}
+
+// Parses header without its length octet, malformed trailing elements are dropped
+func parseUDH(b []byte) UDH {
+	var h UDH
+	for len(b) >= 2 {
+		n := int(b[1])
+		if 2+n > len(b) {
+			break
+		}
+		h = append(h, IE{b[0], append([]byte(nil), b[2:2+n]...)})
+		b = b[2+n:]
+	}
+	return h
+}
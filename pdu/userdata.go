@@ -0,0 +1,174 @@
+package pdu
+
+import (
+	"fmt"
+	"unicode/utf16"
+
+	"github.com/gemaalief/gsmgo/gsm7"
+)
+
+// Character set of user data
+type Alphabet byte
+
+const (
+	AlphabetDefault Alphabet = 0 // GSM 7-bit default alphabet
+	Alphabet8bit    Alphabet = 1
+	AlphabetUCS2    Alphabet = 2
+)
+
+func (a Alphabet) String() string {
+	switch a {
+	case AlphabetDefault:
+		return "default"
+	case Alphabet8bit:
+		return "8bit"
+	case AlphabetUCS2:
+		return "UCS-2"
+	}
+	return "reserved"
+}
+
+// Returns data coding scheme (TP-DCS) for alphabet and message class, -1 for no class
+func DCS(alphabet Alphabet, class int) byte {
+	dcs := byte(alphabet) << 2
+	if class >= 0 && class <= 3 {
+		dcs |= 0x10 | byte(class)
+	}
+	return dcs
+}
+
+// Returns alphabet and message class of data coding scheme, see 3GPP TS 23.038 4
+func ParseDCS(dcs byte) (alphabet Alphabet, class int, compressed bool) {
+	class = -1
+	switch dcs >> 4 {
+	case 0x0, 0x1, 0x2, 0x3, 0x4, 0x5, 0x6, 0x7:
+		// general data coding and automatic deletion groups
+		alphabet = Alphabet(dcs >> 2 & 0x03)
+		if alphabet > AlphabetUCS2 {
+			alphabet = AlphabetDefault
+		}
+		if dcs&0x10 != 0 {
+			class = int(dcs & 0x03)
+		}
+		compressed = dcs&0x20 != 0
+	case 0xC, 0xD:
+		// message waiting indication, discard or store
+		alphabet = AlphabetDefault
+	case 0xE:
+		alphabet = AlphabetUCS2
+	case 0xF:
+		alphabet = AlphabetDefault
+		if dcs&0x04 != 0 {
+			alphabet = Alphabet8bit
+		}
+		class = int(dcs & 0x03)
+	}
+	return
+}
+
+// Returns user data length (TP-UDL) and user data with header,
+// national language tables are used for the default alphabet only
+func encodeUserData(udh UDH, alphabet Alphabet, tables gsm7.Tables, text string, data []byte) (udl byte, ud []byte, err error) {
+	h := header(udh, alphabet, tables).Bytes()
+
+	switch alphabet {
+	case AlphabetDefault:
+		septets, err := tables.Encode(text)
+		if err != nil {
+			return 0, nil, err
+		}
+		fill := fillBits(len(h))
+		ud = append(h, gsm7.Pack(septets, fill)...)
+		n := (len(h)*8+fill)/7 + len(septets)
+		if len(ud) > MaxUserData {
+			return 0, nil, fmt.Errorf("pdu: user data too long, %d septets", n)
+		}
+		return byte(n), ud, nil
+	case AlphabetUCS2:
+		for _, u := range utf16.Encode([]rune(text)) {
+			h = append(h, byte(u>>8), byte(u))
+		}
+		ud = h
+	case Alphabet8bit:
+		ud = append(h, data...)
+	default:
+		return 0, nil, fmt.Errorf("pdu: unsupported alphabet %d", alphabet)
+	}
+
+	if len(ud) > MaxUserData {
+		return 0, nil, fmt.Errorf("pdu: user data too long, %d octets", len(ud))
+	}
+	return byte(len(ud)), ud, nil
+}
+
+// Returns header sent with user data, shift elements are added for the default alphabet
+func header(udh UDH, alphabet Alphabet, tables gsm7.Tables) UDH {
+	if alphabet == AlphabetDefault {
+		return udh.withTables(tables)
+	}
+	return udh
+}
+
+// Reads user data, returns text for default alphabet and UCS-2, data otherwise.
+// Default alphabet text is decoded with the tables selected by the header,
+// tables of unsupported languages fail with *gsm7.UnsupportedError.
+func (r *reader) userData(udhi bool, alphabet Alphabet) (udh UDH, text string, data []byte) {
+	udl := int(r.byte())
+	ud := r.rest()
+	if r.err != nil {
+		return
+	}
+
+	n := 0 // header octets
+	if udhi && len(ud) > 0 {
+		n = 1 + int(ud[0])
+		if n > len(ud) {
+			r.err = ErrShort
+			return
+		}
+		udh = parseUDH(ud[1:n])
+	}
+
+	if alphabet == AlphabetDefault {
+		fill := fillBits(n)
+		septets := udl - (n*8+fill)/7
+		if septets < 0 {
+			r.err = fmt.Errorf("pdu: user data header longer than %d septets", udl)
+			return
+		}
+		if udl > len(ud)*8/7 {
+			r.err = ErrShort
+			return
+		}
+		text, r.err = udh.Tables().Decode(gsm7.Unpack(ud[n:], fill, septets))
+		return
+	}
+
+	if n > udl {
+		r.err = fmt.Errorf("pdu: user data header longer than %d octets", udl)
+		return
+	}
+	if udl > len(ud) {
+		r.err = ErrShort
+		return
+	}
+	payload := ud[n:udl]
+	if alphabet == AlphabetUCS2 {
+		units := make([]uint16, len(payload)/2)
+		for i := range units {
+			units[i] = uint16(payload[2*i])<<8 | uint16(payload[2*i+1])
+		}
+		text = string(utf16.Decode(units))
+		return
+	}
+	data = append([]byte(nil), payload...)
+	return
+}
+
+// Returns fill bits aligning septets after a header of n octets
+func fillBits(n int) int {
+	if n == 0 {
+		return 0
+	}
+	return (7 - n*8%7) % 7
+}
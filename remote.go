@@ -0,0 +1,394 @@
+package gsm
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"sync"
+	"time"
+)
+
+// Device prefixes of network serial ports
+const (
+	schemeTCP     = "tcp://"     // raw socket, e.g. ser2net in raw mode
+	schemeRFC2217 = "rfc2217://" // Telnet with COM Port Control
+)
+
+// Telnet commands and options, RFC 854, 856, 858 and 2217
+const (
+	telnetSE   = 240
+	telnetSB   = 250
+	telnetWILL = 251
+	telnetWONT = 252
+	telnetDO   = 253
+	telnetDONT = 254
+	telnetIAC  = 255
+
+	optBinary  = 0
+	optSGA     = 3
+	optComPort = 44
+)
+
+// COM-PORT-OPTION commands of the client, the server answers with the command + 100
+const (
+	comSetBaudrate = 1
+	comSetDatasize = 2
+	comSetParity   = 3
+	comSetStopsize = 4
+	comSetControl  = 5
+	comServer      = 100
+)
+
+// SET-PARITY values by ModemConfig.Parity
+var comParity = map[byte]byte{0: 1, 'N': 1, 'O': 2, 'E': 3, 'M': 4, 'S': 5}
+
+// Returned by Read when the remote end closed the connection
+var errConnClosed = errors.New("connection closed")
+
+// Raw TCP connection to a serial port server
+type netPort struct {
+	net.Conn
+}
+
+// Returns connection to tcp://host:port
+func dialTCP(device string) (*netPort, error) {
+	conn, err := net.DialTimeout("tcp", device[len(schemeTCP):], timeOut)
+	if err != nil {
+		return nil, &Error{Code: CodeDeviceOpen, Op: "dial", Msg: err.Error()}
+	}
+	return &netPort{conn}, nil
+}
+
+// EOF means the connection is gone, not a read timeout
+func (p *netPort) Read(b []byte) (int, error) {
+	n, err := p.Conn.Read(b)
+	if err == io.EOF {
+		err = errConnClosed
+	}
+	return n, err
+}
+
+// Telnet connection to a serial port server with COM Port Control, RFC 2217
+type rfc2217Port struct {
+	conn  net.Conn
+	wlock sync.Mutex
+
+	// read side, used by a single reader
+	buf    []byte
+	data   []byte // decoded data not yet read
+	state  int
+	cmd    byte   // option command waiting for its option
+	sb     []byte // subnegotiation being read
+	lastCR bool
+
+	lock       sync.Mutex
+	binaryIn   bool // server sends binary, no NUL after CR
+	binaryOut  bool // server accepts binary
+	comPort    int  // 1 if accepted, -1 if refused
+	replies    map[byte]bool
+	serverBaud int
+}
+
+// Telnet parser states
+const (
+	stateData = iota
+	stateIAC
+	stateOption
+	stateSB
+	stateSBIAC
+)
+
+// Connects to rfc2217://host:port and sets the serial parameters of config.
+//
+// Returns error if the server refuses COM-PORT-OPTION or does not accept the baud rate.
+func dialRFC2217(config ModemConfig) (p *rfc2217Port, err error) {
+	conn, err := net.DialTimeout("tcp", config.Device[len(schemeRFC2217):], timeOut)
+	if err != nil {
+		return nil, &Error{Code: CodeDeviceOpen, Op: "dial", Msg: err.Error()}
+	}
+
+	p = &rfc2217Port{conn: conn, buf: make([]byte, 256), replies: make(map[byte]bool)}
+	if err = p.negotiate(config); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return
+}
+
+// Negotiates options and sets serial parameters, waits at most timeOut
+func (p *rfc2217Port) negotiate(c ModemConfig) error {
+	p.conn.SetReadDeadline(time.Now().Add(timeOut))
+	defer p.conn.SetReadDeadline(time.Time{})
+
+	err := p.send(
+		telnetIAC, telnetWILL, optBinary, telnetIAC, telnetDO, optBinary,
+		telnetIAC, telnetWILL, optSGA, telnetIAC, telnetDO, optSGA,
+		telnetIAC, telnetWILL, optComPort,
+	)
+	if err != nil {
+		return err
+	}
+	if err = p.wait(func() bool { return p.comPort != 0 }); err != nil {
+		return err
+	}
+	if p.comPort < 0 {
+		return &Error{Code: CodeNotSupported, Op: "rfc2217", Msg: "server refused COM-PORT-OPTION"}
+	}
+
+	rate := c.serial().Baud
+	baud := make([]byte, 4)
+	binary.BigEndian.PutUint32(baud, uint32(rate))
+	datasize := byte(c.DataBits)
+	if datasize == 0 {
+		datasize = 8
+	}
+	parity, ok := comParity[c.Parity]
+	if !ok {
+		return &Error{Code: CodeInvalidData, Op: "rfc2217", Msg: fmt.Sprintf("unsupported parity %q", c.Parity)}
+	}
+	stopsize := byte(1)
+	if c.StopBits == 2 {
+		stopsize = 2
+	}
+	control := byte(1) // no flow control
+	if c.RTSCTS {
+		control = 3
+	}
+	settings := map[byte][]byte{
+		comSetBaudrate: baud,
+		comSetDatasize: {datasize},
+		comSetParity:   {parity},
+		comSetStopsize: {stopsize},
+		comSetControl:  {control},
+	}
+	for _, cmd := range []byte{comSetBaudrate, comSetDatasize, comSetParity, comSetStopsize, comSetControl} {
+		if err = p.subnegotiate(cmd, settings[cmd]...); err != nil {
+			return err
+		}
+	}
+
+	err = p.wait(func() bool {
+		for cmd := range settings {
+			if !p.replies[cmd] {
+				return false
+			}
+		}
+		return true
+	})
+	if err != nil {
+		return err
+	}
+
+	if p.serverBaud != rate {
+		return &Error{Code: CodeNotSupported, Op: "rfc2217", Msg: fmt.Sprintf("baud rate %d not accepted, server uses %d", rate, p.serverBaud)}
+	}
+	log.Printf("--- RFC 2217: %s at %d baud", p.conn.RemoteAddr(), p.serverBaud)
+	return nil
+}
+
+// Reads until done returns true
+func (p *rfc2217Port) wait(done func() bool) error {
+	for {
+		p.lock.Lock()
+		ok := done()
+		p.lock.Unlock()
+		if ok {
+			return nil
+		}
+
+		if err := p.fill(); err != nil {
+			if ne, ok := err.(net.Error); ok && ne.Timeout() {
+				return &Error{Code: CodeTimeout, Op: "rfc2217", Msg: "no reply to option negotiation"}
+			}
+			return &Error{Code: CodeDeviceOpen, Op: "rfc2217", Msg: err.Error()}
+		}
+	}
+}
+
+// Sends COM-PORT-OPTION subnegotiation
+func (p *rfc2217Port) subnegotiate(cmd byte, value ...byte) error {
+	b := []byte{telnetIAC, telnetSB, optComPort, cmd}
+	for _, v := range value {
+		b = append(b, v)
+		if v == telnetIAC {
+			b = append(b, telnetIAC)
+		}
+	}
+	return p.send(append(b, telnetIAC, telnetSE)...)
+}
+
+// Writes telnet commands as they are
+func (p *rfc2217Port) send(b ...byte) error {
+	p.wlock.Lock()
+	defer p.wlock.Unlock()
+
+	_, err := p.conn.Write(b)
+	return err
+}
+
+// Reads from the connection and decodes telnet data into p.data
+func (p *rfc2217Port) fill() error {
+	n, err := p.conn.Read(p.buf)
+	for _, b := range p.buf[:n] {
+		switch p.state {
+		case stateData:
+			if b == telnetIAC {
+				p.state = stateIAC
+				continue
+			}
+			// NVT sends CR NUL for a bare CR
+			cr := p.lastCR
+			p.lastCR = b == '\r'
+			if cr && b == 0 && !p.isBinaryIn() {
+				continue
+			}
+			p.data = append(p.data, b)
+		case stateIAC:
+			switch b {
+			case telnetIAC:
+				p.data = append(p.data, b)
+				p.state = stateData
+			case telnetWILL, telnetWONT, telnetDO, telnetDONT:
+				p.cmd = b
+				p.state = stateOption
+			case telnetSB:
+				p.sb = p.sb[:0]
+				p.state = stateSB
+			default: // NOP, GA and others carry nothing
+				p.state = stateData
+			}
+		case stateOption:
+			if reply := p.option(p.cmd, b); reply != 0 {
+				p.send(telnetIAC, reply, b)
+			}
+			p.state = stateData
+		case stateSB:
+			if b == telnetIAC {
+				p.state = stateSBIAC
+				continue
+			}
+			p.sb = append(p.sb, b)
+		case stateSBIAC:
+			switch b {
+			case telnetSE:
+				p.subnegotiation(p.sb)
+				p.state = stateData
+			case telnetIAC:
+				p.sb = append(p.sb, b)
+				p.state = stateSB
+			default:
+				p.state = stateData
+			}
+		}
+	}
+	if err == io.EOF {
+		err = errConnClosed
+	}
+	return err
+}
+
+func (p *rfc2217Port) isBinaryIn() bool {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return p.binaryIn
+}
+
+// Returns WONT or DONT for options not supported, 0 otherwise. Options asked for
+// in negotiate are not confirmed again.
+func (p *rfc2217Port) option(cmd, opt byte) (reply byte) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	switch cmd {
+	case telnetDO:
+		switch opt {
+		case optBinary:
+			p.binaryOut = true
+		case optComPort:
+			p.comPort = 1
+		case optSGA:
+		default:
+			reply = telnetWONT
+		}
+	case telnetDONT:
+		switch opt {
+		case optBinary:
+			p.binaryOut = false
+		case optComPort:
+			p.comPort = -1
+		}
+	case telnetWILL:
+		switch opt {
+		case optBinary:
+			p.binaryIn = true
+		case optSGA:
+		default:
+			reply = telnetDONT
+		}
+	case telnetWONT:
+		if opt == optBinary {
+			p.binaryIn = false
+		}
+	}
+	return
+}
+
+// Handles COM-PORT-OPTION replies, line and modem state notifications are ignored
+func (p *rfc2217Port) subnegotiation(sb []byte) {
+	if len(sb) < 2 || sb[0] != optComPort || sb[1] <= comServer {
+		return
+	}
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	cmd := sb[1] - comServer
+	p.replies[cmd] = true
+	if cmd == comSetBaudrate && len(sb) >= 6 {
+		p.serverBaud = int(binary.BigEndian.Uint32(sb[2:6]))
+	}
+}
+
+func (p *rfc2217Port) Read(b []byte) (int, error) {
+	for len(p.data) == 0 {
+		if err := p.fill(); err != nil && len(p.data) == 0 {
+			return 0, err
+		}
+	}
+	n := copy(b, p.data)
+	p.data = p.data[n:]
+	return n, nil
+}
+
+// Writes data, doubling IAC and sending CR NUL for a bare CR unless binary
+func (p *rfc2217Port) Write(b []byte) (int, error) {
+	p.lock.Lock()
+	bin := p.binaryOut
+	p.lock.Unlock()
+
+	out := make([]byte, 0, len(b)+1)
+	for i, c := range b {
+		out = append(out, c)
+		switch {
+		case c == telnetIAC:
+			out = append(out, telnetIAC)
+		case c == '\r' && !bin && (i+1 == len(b) || b[i+1] != '\n'):
+			out = append(out, 0)
+		}
+	}
+
+	p.wlock.Lock()
+	defer p.wlock.Unlock()
+
+	if _, err := p.conn.Write(out); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+func (p *rfc2217Port) Close() error {
+	return p.conn.Close()
+}
@@ -0,0 +1,148 @@
+package gsm
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+// Returns port on one end of a pipe and the other end as the server
+func pipePort() (*rfc2217Port, net.Conn) {
+	client, server := net.Pipe()
+	return &rfc2217Port{conn: client, buf: make([]byte, 256), replies: make(map[byte]bool)}, server
+}
+
+func TestRFC2217Write(t *testing.T) {
+	tests := []struct {
+		binary bool
+		data   string
+		want   string
+	}{
+		{false, "AT\r", "AT\r\x00"},
+		{false, "AT\r\n", "AT\r\n"},
+		{false, "\xff\x1a", "\xff\xff\x1a"},
+		{true, "AT\r\xff", "AT\r\xff\xff"},
+	}
+
+	for _, tt := range tests {
+		p, server := pipePort()
+		p.binaryOut = tt.binary
+
+		got := make(chan []byte, 1)
+		go func() {
+			b, _ := io.ReadAll(server)
+			got <- b
+		}()
+
+		n, err := p.Write([]byte(tt.data))
+		if err != nil || n != len(tt.data) {
+			t.Errorf("Write(%q) = %d, %v", tt.data, n, err)
+		}
+		p.Close()
+		if b := <-got; string(b) != tt.want {
+			t.Errorf("Write(%q) sent %q, want %q", tt.data, b, tt.want)
+		}
+	}
+}
+
+func TestRFC2217Read(t *testing.T) {
+	p, server := pipePort()
+	defer p.Close()
+
+	go func() {
+		server.Write([]byte("OK\r\x00\xff\xff"))
+		// NOP and a line state notification carry no data
+		server.Write([]byte{telnetIAC, 241, 'A', telnetIAC, telnetSB, optComPort, 106, 0x60, telnetIAC, telnetSE, 'B'})
+		server.Write([]byte{telnetIAC, telnetSB, optComPort, comServer + comSetBaudrate, 0, 0, 0x25, 0x80, telnetIAC, telnetSE})
+		server.Close()
+	}()
+
+	var got []byte
+	buf := make([]byte, 16)
+	var err error
+	for {
+		var n int
+		n, err = p.Read(buf)
+		got = append(got, buf[:n]...)
+		if err != nil {
+			break
+		}
+	}
+
+	if want := "OK\r\xffAB"; string(got) != want {
+		t.Errorf("Read = %q, want %q", got, want)
+	}
+	if err != errConnClosed {
+		t.Errorf("Read at close err = %v, want %v", err, errConnClosed)
+	}
+	if p.serverBaud != 9600 || !p.replies[comSetBaudrate] {
+		t.Errorf("baud reply not recorded: %d", p.serverBaud)
+	}
+}
+
+func TestRFC2217Options(t *testing.T) {
+	p, server := pipePort()
+	defer p.Close()
+
+	// echo is refused, binary and COM-PORT-OPTION are accepted without reply
+	replies := make(chan []byte, 1)
+	go func() {
+		server.Write([]byte{telnetIAC, telnetWILL, 1, telnetIAC, telnetDO, optBinary, telnetIAC, telnetDO, optComPort})
+		b := make([]byte, 3)
+		io.ReadFull(server, b)
+		replies <- b
+	}()
+
+	for p.comPort == 0 {
+		if err := p.fill(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if b := <-replies; !bytes.Equal(b, []byte{telnetIAC, telnetDONT, 1}) {
+		t.Errorf("reply to WILL ECHO = %v", b)
+	}
+	if !p.binaryOut || p.comPort != 1 {
+		t.Errorf("binaryOut, comPort = %v, %d", p.binaryOut, p.comPort)
+	}
+}
+
+func TestNetPortClosed(t *testing.T) {
+	client, server := net.Pipe()
+	p := &netPort{client}
+
+	server.Close()
+	if _, err := p.Read(make([]byte, 1)); err != errConnClosed {
+		t.Errorf("Read err = %v, want %v", err, errConnClosed)
+	}
+
+	// modem fails commands once the server is gone
+	client, server = net.Pipe()
+	m := NewModemPort(&netPort{client})
+	defer m.Close()
+	server.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, err := m.Exec(ctx, "AT"); !errors.Is(err, ErrDeviceIO) {
+		t.Errorf("Exec err = %v, want device I/O error", err)
+	}
+}
+
+func TestDialRefused(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := l.Addr().String()
+	l.Close()
+
+	for _, device := range []string{"tcp://" + addr, "rfc2217://" + addr} {
+		if _, err := NewModem(device); !errors.Is(err, ErrDeviceOpen) {
+			t.Errorf("NewModem(%s) err = %v, want device open error", device, err)
+		}
+	}
+}
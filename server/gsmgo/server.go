@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"flag"
 	"fmt"
@@ -10,18 +11,28 @@ import (
 	"os"
 	"os/user"
 	"path/filepath"
+	"strconv"
+	"time"
 
 	gsm "github.com/gemaalief/gsmgo"
 )
 
-var (
-	g            *gsm.GSM
-	username     *string
-	password     *string
-	httpListener net.Listener
-)
+// Send and USSD requests wait at most this long for the modem
+const requestTimeout = 60 * time.Second
+
+var httpListener net.Listener
+
+// Returns handler sending SMS and USSD requests with backend, requests need basic
+// authentication if username and password are set
+func newHandler(backend gsm.Backend, username, password string) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		handleSMS(w, r, backend, username, password)
+	})
+	return mux
+}
 
-func handleSMS(w http.ResponseWriter, r *http.Request) {
+func handleSMS(w http.ResponseWriter, r *http.Request, backend gsm.Backend, username, password string) {
 	w.Header().Set("Server", fmt.Sprintf("%s/%s", "GSMGo", "1.1"))
 
 	if r.Method != "POST" {
@@ -29,9 +40,9 @@ func handleSMS(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if *username != "" && *password != "" {
+	if username != "" && password != "" {
 		user, pass, _ := r.BasicAuth()
-		if !checkAuth(user, pass) {
+		if user != username || pass != password {
 			http.Error(w, "401 Unauthorized", http.StatusUnauthorized)
 			return
 		}
@@ -57,45 +68,32 @@ func handleSMS(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	ctx, cancel := context.WithTimeout(r.Context(), requestTimeout)
+	defer cancel()
+
 	w.Header().Set("Content-Type", "application/json; charset=utf-8")
 	if mode == "sms" {
-		if len(text) <= 160 {
-			err = g.SendSMS(text, number)
-			if err != nil {
-				js, _ := json.MarshalIndent(map[string]string{"status": "ERROR", "message": err.Error()}, "", "    ")
-				w.Write(js)
-			} else {
-				js, _ := json.MarshalIndent(map[string]string{"status": "OK", "message": "success"}, "", "    ")
-				w.Write(js)
-			}
+		result, err := backend.SendContext(ctx, text, number)
+		if err != nil {
+			js, _ := json.MarshalIndent(map[string]string{"status": "ERROR", "message": err.Error()}, "", "    ")
+			w.Write(js)
 		} else {
-			err = g.SendLongSMS(text, number)
-			if err != nil {
-				js, _ := json.MarshalIndent(map[string]string{"status": "ERROR", "message": err.Error()}, "", "    ")
-				w.Write(js)
-			} else {
-				js, _ := json.MarshalIndent(map[string]string{"status": "OK", "message": "success"}, "", "    ")
-				w.Write(js)
-			}
+			js, _ := json.MarshalIndent(map[string]string{"status": "OK", "message": "success", "parts": strconv.Itoa(result.Parts())}, "", "    ")
+			w.Write(js)
 		}
 	} else if mode == "ussd" {
-		msg, err := g.GetUSSDByCode(code, "")
+		resp, err := backend.USSDContext(ctx, code)
 		if err != nil {
 			js, _ := json.MarshalIndent(map[string]string{"status": "ERROR", "message": err.Error()}, "", "    ")
 			w.Write(js)
 		} else {
-			js, _ := json.MarshalIndent(map[string]string{"status": "OK", "message": "success", "data": msg}, "", "    ")
+			js, _ := json.MarshalIndent(map[string]string{"status": "OK", "message": "success", "data": resp.Text}, "", "    ")
 			w.Write(js)
 		}
 	}
 }
 
-func startHTTP(bind string) {
-	mux := http.NewServeMux()
-	mux.HandleFunc("/", handleSMS)
-
-	handler := http.Handler(mux)
-
+func startHTTP(bind string, handler http.Handler) {
 	s := &http.Server{
 		Addr:    bind,
 		Handler: handler,
@@ -111,25 +109,16 @@ func startHTTP(bind string) {
 	}
 }
 
-func checkAuth(u string, p string) bool {
-	if *username == u && *password == p {
-		return true
-	}
-	return false
-}
-
 func main() {
 	cfg := flag.String("config", "", "Config file")
 	bind := flag.String("bind", ":38164", "Bind address")
 	debug := flag.Bool("debug", false, "Enable debugging")
-	username = flag.String("username", "", "Username")
-	password = flag.String("password", "", "Password")
+	username := flag.String("username", "", "Username")
+	password := flag.String("password", "", "Password")
 	sectionPtr := flag.Int("section", 0, "called gammu section")
 	flag.Parse()
 
-	var err error
-
-	g, err = gsm.NewGSM()
+	g, err := gsm.NewGSM()
 	if err != nil {
 		log.Printf("Error NewGSM: %v", err)
 	}
@@ -176,11 +165,13 @@ func main() {
 		log.Printf("Error Connect: %v", err)
 	}
 
-	cb := func(tes, tes2 string) error {
-		log.Println(tes + " - " + tes2)
+	// the message handler replaces the default logging callback
+	g.SetCallBack(nil)
+
+	g.SetMessageHandler(func(msg *gsm.Message) error {
+		log.Println(msg.Number + " - " + msg.Text)
 		return nil
-	}
-	g.SetCallBack(cb)
+	})
 
 	err = g.WaitForSMS(1)
 	if err != nil {
@@ -192,6 +183,6 @@ func main() {
 		os.Exit(1)
 	} else {
 		log.Printf("Phone is connected")
-		startHTTP(*bind)
+		startHTTP(*bind, newHandler(g, *username, *password))
 	}
 }
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	gsm "github.com/gemaalief/gsmgo"
+	"github.com/gemaalief/gsmgo/gsmtest"
+)
+
+// Posts body to server and returns status code and decoded JSON reply
+func post(t *testing.T, srv *httptest.Server, body string, auth ...string) (int, map[string]string) {
+	t.Helper()
+
+	req, err := http.NewRequest("POST", srv.URL, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(auth) == 2 {
+		req.SetBasicAuth(auth[0], auth[1])
+	}
+	resp, err := srv.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	var reply map[string]string
+	if resp.StatusCode == http.StatusOK {
+		if err := json.NewDecoder(resp.Body).Decode(&reply); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return resp.StatusCode, reply
+}
+
+func TestHandlerSMS(t *testing.T) {
+	fake := gsmtest.NewFake()
+	srv := httptest.NewServer(newHandler(fake, "", ""))
+	defer srv.Close()
+
+	code, reply := post(t, srv, `{"text": "`+strings.Repeat("x", 200)+`", "number": "+38164123456"}`)
+	if code != http.StatusOK || reply["status"] != "OK" || reply["parts"] != "2" {
+		t.Errorf("reply = %d %v", code, reply)
+	}
+	if len(fake.Sent) != 1 || fake.Sent[0].Number != "+38164123456" {
+		t.Errorf("sent = %+v", fake.Sent)
+	}
+
+	fake.Err = gsm.ErrNoSIM
+	code, reply = post(t, srv, `{"text": "x", "number": "+1"}`)
+	if code != http.StatusOK || reply["status"] != "ERROR" || reply["message"] != gsm.ErrNoSIM.Error() {
+		t.Errorf("reply on error = %d %v", code, reply)
+	}
+}
+
+func TestHandlerUSSD(t *testing.T) {
+	fake := gsmtest.NewFake()
+	fake.USSD["*100#"] = &gsm.USSDResponse{Status: gsm.USSDNoActionNeeded, Text: "Balance 12.00", DCS: 15}
+	srv := httptest.NewServer(newHandler(fake, "", ""))
+	defer srv.Close()
+
+	code, reply := post(t, srv, `{"mode": "ussd", "code": "*100#"}`)
+	if code != http.StatusOK || reply["status"] != "OK" || reply["data"] != "Balance 12.00" {
+		t.Errorf("reply = %d %v", code, reply)
+	}
+
+	code, reply = post(t, srv, `{"mode": "ussd", "code": "*999#"}`)
+	if code != http.StatusOK || reply["status"] != "ERROR" {
+		t.Errorf("unknown code reply = %d %v", code, reply)
+	}
+}
+
+func TestHandlerRejects(t *testing.T) {
+	fake := gsmtest.NewFake()
+	srv := httptest.NewServer(newHandler(fake, "user", "secret"))
+	defer srv.Close()
+
+	tests := []struct {
+		name string
+		body string
+		auth []string
+		code int
+	}{
+		{"no auth", `{"text": "x", "number": "+1"}`, nil, http.StatusUnauthorized},
+		{"wrong password", `{"text": "x", "number": "+1"}`, []string{"user", "wrong"}, http.StatusUnauthorized},
+		{"invalid json", `{"text": `, []string{"user", "secret"}, http.StatusInternalServerError},
+		{"missing number", `{"text": "x"}`, []string{"user", "secret"}, http.StatusBadRequest},
+		{"missing code", `{"mode": "ussd"}`, []string{"user", "secret"}, http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if code, _ := post(t, srv, tt.body, tt.auth...); code != tt.code {
+				t.Errorf("status = %d, want %d", code, tt.code)
+			}
+		})
+	}
+
+	resp, err := srv.Client().Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("GET status = %d", resp.StatusCode)
+	}
+
+	if len(fake.Sent) != 0 {
+		t.Errorf("rejected requests sent %d messages", len(fake.Sent))
+	}
+}
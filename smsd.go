@@ -6,7 +6,6 @@ package gsm
 import "C"
 
 import (
-	"errors"
 	"log"
 )
 
@@ -19,7 +18,7 @@ func StartSMSD(config string, programName string) (err error) {
 	name := C.CString(programName)
 	cfg = C.SMSD_NewConfig(name)
 	if cfg == nil {
-		err = errors.New("Cannot create config")
+		err = &Error{Code: CodeMemory, Op: "smsd", Msg: "Cannot create config"}
 
 		return
 	}
@@ -28,7 +27,7 @@ func StartSMSD(config string, programName string) (err error) {
 	e := C.SMSD_ReadConfig(path, cfg, C.gboolean(1))
 	if e != ERR_NONE {
 		log.Println("failed to read config")
-		err = errors.New(errorString(int(e)))
+		err = newError("smsd", e)
 		return
 	}
 
@@ -36,7 +35,7 @@ func StartSMSD(config string, programName string) (err error) {
 	if e != ERR_NONE {
 		log.Println("Failed to run SMSD!")
 		C.SMSD_FreeConfig(cfg)
-		err = errors.New(errorString(int(e)))
+		err = newError("smsd", e)
 
 		return
 	}
@@ -0,0 +1,231 @@
+package gsm
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Transcript directions
+const (
+	sent     = '>' // written to the modem
+	received = '<' // read from the modem
+)
+
+// Transcript of modem traffic, one chunk per line:
+//
+//	# gsmgo transcript 2006-01-02T15:04:05.999999999Z07:00
+//	0.000012 > "AT+CSQ\r"
+//	0.010344 < "\r\n+CSQ: 20,99\r\n\r\nOK\r\n"
+//
+// Time is seconds since the start, data is a Go quoted string.
+type recorder struct {
+	sync.Mutex
+	f     *os.File
+	start time.Time
+}
+
+// Starts writing a transcript of every byte sent and received to file at path,
+// an existing file is truncated. Empty path stops recording.
+func (m *Modem) Record(path string) error {
+	var r *recorder
+	if path != "" {
+		f, err := os.Create(path)
+		if err != nil {
+			return err
+		}
+		r = &recorder{f: f, start: time.Now()}
+		fmt.Fprintf(f, "# gsmgo transcript %s\n", r.start.Format(time.RFC3339Nano))
+	}
+
+	m.lock.Lock()
+	old := m.recorder
+	m.recorder = r
+	m.lock.Unlock()
+
+	if old != nil {
+		old.Lock()
+		defer old.Unlock()
+		return old.f.Close()
+	}
+	return nil
+}
+
+// Writes chunk to the transcript if recording
+func (m *Modem) record(dir byte, data []byte) {
+	if len(data) == 0 {
+		return
+	}
+
+	m.lock.Lock()
+	r := m.recorder
+	m.lock.Unlock()
+	if r == nil {
+		return
+	}
+
+	r.Lock()
+	defer r.Unlock()
+	fmt.Fprintf(r.f, "%.6f %c %s\n", time.Since(r.start).Seconds(), dir, strconv.Quote(string(data)))
+}
+
+// Chunk of a transcript
+type chunk struct {
+	at   time.Duration
+	dir  byte
+	data []byte
+}
+
+// Port replaying a transcript written by Modem.Record.
+//
+// Received chunks are returned by Read once everything recorded before them
+// was written, so replies follow their commands. Writes have to match the
+// recorded data, otherwise Write fails. After the last chunk Read blocks until Close.
+type Replay struct {
+	Realtime bool // keep recorded delays between chunks
+
+	lock    sync.Mutex
+	cond    *sync.Cond
+	chunks  []chunk
+	pos     int    // next chunk
+	partial []byte // rest of a received chunk not read yet
+	written []byte // written data not yet matched to a sent chunk
+	last    time.Duration
+	closed  bool
+}
+
+// Returns replay of transcript file at path
+func OpenReplay(path string) (*Replay, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return NewReplay(f)
+}
+
+// Returns replay of transcript read from r
+func NewReplay(r io.Reader) (*Replay, error) {
+	p := &Replay{}
+	p.cond = sync.NewCond(&p.lock)
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.SplitN(line, " ", 3)
+		if len(fields) != 3 || len(fields[1]) != 1 || (fields[1][0] != sent && fields[1][0] != received) {
+			return nil, fmt.Errorf("transcript line %d: invalid chunk", n)
+		}
+		seconds, err := strconv.ParseFloat(fields[0], 64)
+		if err != nil {
+			return nil, fmt.Errorf("transcript line %d: %v", n, err)
+		}
+		data, err := strconv.Unquote(fields[2])
+		if err != nil {
+			return nil, fmt.Errorf("transcript line %d: %v", n, err)
+		}
+
+		p.chunks = append(p.chunks, chunk{
+			at:   time.Duration(seconds * float64(time.Second)),
+			dir:  fields[1][0],
+			data: []byte(data),
+		})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// Returns next received chunk, waiting for the writes recorded before it
+func (p *Replay) Read(b []byte) (int, error) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	for len(p.partial) == 0 {
+		if p.closed {
+			return 0, os.ErrClosed
+		}
+		if p.pos < len(p.chunks) && p.chunks[p.pos].dir == received {
+			c := p.chunks[p.pos]
+			p.pos++
+			if p.Realtime && c.at > p.last {
+				p.lock.Unlock()
+				time.Sleep(c.at - p.last)
+				p.lock.Lock()
+			}
+			p.last = c.at
+			p.partial = c.data
+			continue
+		}
+		p.cond.Wait()
+	}
+
+	n := copy(b, p.partial)
+	p.partial = p.partial[n:]
+	return n, nil
+}
+
+// Matches data against sent chunks, fails on data not in the transcript
+func (p *Replay) Write(b []byte) (int, error) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if p.closed {
+		return 0, os.ErrClosed
+	}
+
+	p.written = append(p.written, b...)
+	for len(p.written) > 0 {
+		if p.pos >= len(p.chunks) || p.chunks[p.pos].dir != sent {
+			return 0, fmt.Errorf("replay: unexpected write %q", p.written)
+		}
+		want := p.chunks[p.pos].data
+		n := len(want)
+		if len(p.written) < n {
+			n = len(p.written)
+		}
+		if string(p.written[:n]) != string(want[:n]) {
+			return 0, fmt.Errorf("replay: wrote %q, recorded %q", p.written, want)
+		}
+		if n < len(want) {
+			// rest of the chunk comes with the next write
+			break
+		}
+		p.written = p.written[n:]
+		p.pos++
+		p.last = p.chunks[p.pos-1].at
+	}
+
+	p.cond.Broadcast()
+	return len(b), nil
+}
+
+// Reports whether all chunks were replayed
+func (p *Replay) Done() bool {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	return p.pos == len(p.chunks) && len(p.partial) == 0
+}
+
+// Unblocks pending reads, later calls fail
+func (p *Replay) Close() error {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	p.closed = true
+	p.cond.Broadcast()
+	return nil
+}
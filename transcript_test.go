@@ -0,0 +1,146 @@
+package gsm_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	gsm "github.com/gemaalief/gsmgo"
+	"github.com/gemaalief/gsmgo/gsmtest"
+)
+
+// Commands run against the simulator and the replay of their transcript
+func session(ctx context.Context, m *gsm.Modem) (signal string, ussd string, err error) {
+	resp, err := m.Exec(ctx, "AT+CSQ")
+	if err != nil {
+		return
+	}
+	signal = strings.Join(resp.Lines, "\n")
+
+	r, err := gsm.NewUSSDSession(m).StartContext(ctx, "*100#")
+	if err != nil {
+		return
+	}
+	return signal, r.Text, nil
+}
+
+func TestRecordReplay(t *testing.T) {
+	sim, err := gsmtest.NewSimulator()
+	if errors.Is(err, gsm.ErrNotSupported) {
+		t.Skip(err)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sim.Close()
+	sim.USSD("*100#", gsm.USSDNoActionNeeded, "Balance 12.00")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	m, err := gsm.NewModemWithConfig(gsm.ModemConfig{Device: sim.Path, ReadTimeout: 100 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "session.txt")
+	if err := m.Record(path); err != nil {
+		t.Fatal(err)
+	}
+	signal, ussd, err := session(ctx, m)
+	m.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	replay, err := gsm.OpenReplay(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m = gsm.NewModemPort(replay)
+	defer m.Close()
+
+	rsignal, russd, err := session(ctx, m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rsignal != signal || russd != ussd {
+		t.Errorf("replay = %q, %q, recorded %q, %q", rsignal, russd, signal, ussd)
+	}
+	if !replay.Done() {
+		t.Error("transcript not fully replayed")
+	}
+}
+
+// Transcript of a modem sending a numeric USSD reply, as a customer would send it
+const ussdTranscript = `# gsmgo transcript 2026-10-16T12:00:00Z
+0.000100 > "AT+CSCS=\"GSM\"\r"
+0.010000 < "\r\nOK\r\n"
+0.020000 > "AT+CUSD=1,\"*101#\",15\r"
+0.030000 < "\r\nOK\r\n"
+0.900000 < "\r\n+CUSD: 0,\"12345678\",15\r\n"
+`
+
+func TestReplayUSSD(t *testing.T) {
+	m := gsm.NewModemPort(mustReplay(t, ussdTranscript))
+	defer m.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	resp, err := gsm.NewUSSDSession(m).StartContext(ctx, "*101#")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Text != "12345678" {
+		t.Errorf("Text = %q, want 12345678", resp.Text)
+	}
+}
+
+func TestReplayMismatch(t *testing.T) {
+	replay := mustReplay(t, ussdTranscript)
+	defer replay.Close()
+
+	if _, err := replay.Write([]byte("AT+CS")); err != nil {
+		t.Fatalf("partial write: %v", err)
+	}
+	if _, err := replay.Write([]byte("Q\r")); err == nil {
+		t.Error("write differing from the transcript succeeded")
+	}
+
+	m := gsm.NewModemPort(mustReplay(t, ussdTranscript))
+	defer m.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if _, err := m.Exec(ctx, "AT+CGMI"); !errors.Is(err, gsm.ErrDeviceIO) {
+		t.Errorf("Exec of command not in transcript err = %v", err)
+	}
+}
+
+func TestReplayInvalid(t *testing.T) {
+	for _, transcript := range []string{
+		"0.1 ? \"AT\"\n",
+		"x > \"AT\"\n",
+		"0.1 > AT\n",
+	} {
+		if _, err := gsm.NewReplay(strings.NewReader(transcript)); err == nil {
+			t.Errorf("NewReplay(%q) succeeded", transcript)
+		}
+	}
+
+	if _, err := gsm.OpenReplay(filepath.Join(t.TempDir(), "missing")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("OpenReplay of missing file err = %v", err)
+	}
+}
+
+func mustReplay(t *testing.T, transcript string) *gsm.Replay {
+	t.Helper()
+	replay, err := gsm.NewReplay(strings.NewReader(transcript))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return replay
+}
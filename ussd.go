@@ -0,0 +1,343 @@
+package gsm
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf16"
+
+	"github.com/gemaalief/gsmgo/gsm7"
+)
+
+// USSD session status, values match the +CUSD <m> field
+type USSDStatus int
+
+const (
+	USSDUnknown        USSDStatus = iota - 1
+	USSDNoActionNeeded            // no further user action required
+	USSDActionNeeded              // network expects a reply
+	USSDTerminated                // terminated by network
+	USSDAnotherClient             // other local client has responded
+	USSDNotSupported              // operation not supported
+	USSDTimeout                   // network timeout
+)
+
+func (s USSDStatus) String() string {
+	switch s {
+	case USSDNoActionNeeded:
+		return "no action needed"
+	case USSDActionNeeded:
+		return "action needed"
+	case USSDTerminated:
+		return "terminated"
+	case USSDAnotherClient:
+		return "another client"
+	case USSDNotSupported:
+		return "not supported"
+	case USSDTimeout:
+		return "timeout"
+	}
+	return "unknown"
+}
+
+// Decoded USSD network reply
+type USSDResponse struct {
+	Status USSDStatus
+	Text   string
+	DCS    int // data coding scheme, -1 if not known
+}
+
+// Returns error for statuses that carry no usable reply
+func (r *USSDResponse) err() error {
+	switch r.Status {
+	case USSDNotSupported:
+		return &Error{Code: CodeNotSupported, Op: "ussd"}
+	case USSDTimeout:
+		return &Error{Code: CodeTimeout, Op: "ussd", Msg: "network timeout"}
+	}
+	return nil
+}
+
+// Interactive USSD session on an AT modem, for menus that expect replies.
+//
+// A session is not safe for concurrent use.
+type USSDSession struct {
+	Timeout time.Duration // wait for each network reply, 30 seconds if zero
+	Charset string        // character set selected with AT+CSCS on Start, "GSM" if empty
+
+	// Input and default alphabet replies are hex of packed septets, as Huawei
+	// modems expect and send them. Implied by the "HEX" charset.
+	Packed bool
+
+	modem *Modem
+	last  *USSDResponse
+}
+
+// Returns new USSD session on modem
+func NewUSSDSession(m *Modem) *USSDSession {
+	return &USSDSession{modem: m}
+}
+
+// Sends USSD code and returns the first network reply
+func (s *USSDSession) Start(code string) (*USSDResponse, error) {
+	return s.StartContext(context.Background(), code)
+}
+
+// Like Start, waiting until ctx is done or Timeout passes
+func (s *USSDSession) StartContext(ctx context.Context, code string) (*USSDResponse, error) {
+	_, err := s.modem.Exec(ctx, fmt.Sprintf("AT+CSCS=\"%s\"", s.charset()))
+	if err != nil {
+		return nil, err
+	}
+	return s.send(ctx, code)
+}
+
+// Sends input to the network, valid while Waiting returns true
+func (s *USSDSession) Reply(input string) (*USSDResponse, error) {
+	return s.ReplyContext(context.Background(), input)
+}
+
+// Like Reply, waiting until ctx is done or Timeout passes
+func (s *USSDSession) ReplyContext(ctx context.Context, input string) (*USSDResponse, error) {
+	if !s.Waiting() {
+		return nil, &Error{Code: CodeInvalidData, Op: "ussd", Msg: "network does not expect a reply"}
+	}
+	return s.send(ctx, input)
+}
+
+// Ends the session (AT+CUSD=2)
+func (s *USSDSession) Cancel() error {
+	return s.CancelContext(context.Background())
+}
+
+// Like Cancel, waiting until ctx is done
+func (s *USSDSession) CancelContext(ctx context.Context) error {
+	s.last = nil
+	_, err := s.modem.Exec(ctx, "AT+CUSD=2")
+	return err
+}
+
+// Reports whether the network expects further input (+CUSD mode 1)
+func (s *USSDSession) Waiting() bool {
+	return s.last != nil && s.last.Status == USSDActionNeeded
+}
+
+// Returns last network reply, nil before Start
+func (s *USSDSession) Last() *USSDResponse {
+	return s.last
+}
+
+func (s *USSDSession) charset() string {
+	if s.Charset == "" {
+		return "GSM"
+	}
+	return s.Charset
+}
+
+// Returns charset replies are decoded with, "HEX" for packed septets
+func (s *USSDSession) replyCharset() string {
+	if s.Packed {
+		return "HEX"
+	}
+	return s.charset()
+}
+
+func (s *USSDSession) send(ctx context.Context, input string) (*USSDResponse, error) {
+	if strings.EqualFold(s.replyCharset(), "HEX") {
+		packed, err := packUSSD(input)
+		if err != nil {
+			return nil, err
+		}
+		input = packed
+	}
+
+	timeout := s.Timeout
+	if timeout == 0 {
+		timeout = 30 * time.Second
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	s.last = nil
+	replies := make(chan *URC, 1)
+	remove := s.modem.Handle("+CUSD", func(u *URC) {
+		select {
+		case replies <- u:
+		default:
+		}
+	})
+	defer remove()
+
+	_, err := s.modem.Exec(ctx, fmt.Sprintf("AT+CUSD=1,\"%s\",15", input))
+	if err != nil {
+		return nil, err
+	}
+
+	// reply arrives as unsolicited +CUSD after OK
+	select {
+	case u := <-replies:
+		resp, err := ParseCUSDCharset(u.Line, s.replyCharset())
+		if err != nil {
+			return nil, err
+		}
+		s.last = resp
+		return resp, resp.err()
+	case <-ctx.Done():
+		return nil, contextError(ctx, "ussd")
+	}
+}
+
+// Parses +CUSD: <m>[,"<str>"[,<dcs>]] result code sent with the GSM
+// character set, see ParseCUSDCharset.
+func ParseCUSD(line string) (*USSDResponse, error) {
+	return ParseCUSDCharset(line, "GSM")
+}
+
+// Parses +CUSD result code sent with charset selected by AT+CSCS, the text
+// is decoded according to its data coding scheme.
+//
+// UCS-2 and 8-bit text is decoded from hex when it looks like hex. Default
+// alphabet text is decoded from hex only for the "HEX" charset, as packed
+// septets Huawei modems send (see USSDSession.Packed), and "UCS2". Anything
+// else is returned as sent by the modem.
+func ParseCUSDCharset(line, charset string) (*USSDResponse, error) {
+	resp, complete, err := parseCUSD(line, charset)
+	if err == nil && !complete {
+		err = &Error{Code: CodeInvalidData, Op: "parse cusd", Msg: "incomplete +CUSD"}
+	}
+	return resp, err
+}
+
+// Parses first +CUSD in output, complete is false if the text is cut off
+func parseCUSD(output, charset string) (resp *USSDResponse, complete bool, err error) {
+	i := strings.Index(output, "+CUSD:")
+	if i < 0 {
+		return nil, false, &Error{Code: CodeInvalidData, Op: "parse cusd", Msg: "no +CUSD in response"}
+	}
+	rest := strings.TrimLeft(output[i+len("+CUSD:"):], " ")
+
+	mode, rest, ok := number(rest)
+	if !ok {
+		return nil, false, &Error{Code: CodeInvalidData, Op: "parse cusd", Msg: "missing mode"}
+	}
+	resp = &USSDResponse{Status: USSDStatus(mode), DCS: -1}
+
+	rest = strings.TrimLeft(rest, " ")
+	if !strings.HasPrefix(rest, ",") {
+		return resp, true, nil
+	}
+	rest = strings.TrimLeft(rest[1:], " ")
+	if !strings.HasPrefix(rest, "\"") {
+		return nil, false, &Error{Code: CodeInvalidData, Op: "parse cusd", Msg: "missing quoted text"}
+	}
+	end := strings.Index(rest[1:], "\"")
+	if end < 0 {
+		return nil, false, nil
+	}
+	text := rest[1 : 1+end]
+
+	rest = strings.TrimLeft(rest[2+end:], " ")
+	if strings.HasPrefix(rest, ",") {
+		if dcs, _, ok := number(strings.TrimLeft(rest[1:], " ")); ok {
+			resp.DCS = dcs
+		}
+	}
+
+	resp.Text = decodeUSSD(text, resp.DCS, charset)
+	return resp, true, nil
+}
+
+// Returns leading decimal number of s and the rest
+func number(s string) (int, string, bool) {
+	n := 0
+	for n < len(s) && s[n] >= '0' && s[n] <= '9' {
+		n++
+	}
+	if n == 0 {
+		return 0, s, false
+	}
+	v, err := strconv.Atoi(s[:n])
+	return v, s[n:], err == nil
+}
+
+// Returns message coding for cell broadcast data coding scheme, see 3GPP TS 23.038 5
+func cbsCoding(dcs int) Coding {
+	switch {
+	case dcs == 0x11:
+		return CodingUnicode
+	case dcs&0xC0 == 0x40, dcs&0xF0 == 0x90:
+		switch (dcs >> 2) & 0x03 {
+		case 1:
+			return Coding8bit
+		case 2:
+			return CodingUnicode
+		}
+	case dcs&0xF0 == 0xF0:
+		if dcs&0x04 != 0 {
+			return Coding8bit
+		}
+	}
+	return CodingDefault
+}
+
+// Decodes USSD text sent by the modem in charset
+func decodeUSSD(text string, dcs int, charset string) string {
+	data, err := hex.DecodeString(text)
+	if err != nil || len(data) == 0 || dcs < 0 {
+		return text
+	}
+
+	switch cbsCoding(dcs) {
+	case CodingUnicode:
+		return decodeUCS2(data, text)
+	case Coding8bit:
+		runes := make([]rune, len(data))
+		for i, b := range data {
+			runes[i] = rune(b)
+		}
+		return string(runes)
+	}
+
+	switch strings.ToUpper(charset) {
+	case "UCS2":
+		return decodeUCS2(data, text)
+	case "HEX":
+		// packed septets, decoded below
+	default:
+		return text
+	}
+
+	septets := gsm7.Unpack(data, 0, len(data)*8/7)
+	// 7 spare bits at the end are filled with carriage return
+	if len(septets)%8 == 0 && len(septets) > 0 && septets[len(septets)-1] == '\r' {
+		septets = septets[:len(septets)-1]
+	}
+	return gsm7.Decode(septets)
+}
+
+// Returns input as hex of packed septets, 7 spare bits at the end are filled with carriage return
+func packUSSD(input string) (string, error) {
+	septets, err := gsm7.Encode(input)
+	if err != nil {
+		return "", &Error{Code: CodeInvalidData, Op: "ussd", Msg: err.Error()}
+	}
+	if len(septets)%8 == 7 {
+		septets = append(septets, '\r')
+	}
+	return strings.ToUpper(hex.EncodeToString(gsm7.Pack(septets, 0))), nil
+}
+
+// Decodes big-endian UTF-16 data, returns text if data has odd length
+func decodeUCS2(data []byte, text string) string {
+	if len(data)%2 != 0 {
+		return text
+	}
+	units := make([]uint16, len(data)/2)
+	for i := range units {
+		units[i] = uint16(data[2*i])<<8 | uint16(data[2*i+1])
+	}
+	return string(utf16.Decode(units))
+}
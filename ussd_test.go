@@ -0,0 +1,88 @@
+package gsm
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParseCUSDCharset(t *testing.T) {
+	tests := []struct {
+		name    string
+		line    string
+		charset string
+		status  USSDStatus
+		text    string
+		dcs     int
+	}{
+		{"plain", `+CUSD: 0,"Balance 12.00",15`, "GSM", USSDNoActionNeeded, "Balance 12.00", 15},
+		{"numeric plain", `+CUSD: 1,"12345678",15`, "GSM", USSDActionNeeded, "12345678", 15},
+		{"numeric ira", `+CUSD: 0,"1234",15`, "IRA", USSDNoActionNeeded, "1234", 15},
+		{"no dcs", `+CUSD: 0,"ABCD"`, "GSM", USSDNoActionNeeded, "ABCD", -1},
+		{"status only", `+CUSD: 2`, "GSM", USSDTerminated, "", -1},
+		{"spaces", `+CUSD: 0 , "ok" , 15`, "GSM", USSDNoActionNeeded, "ok", 15},
+		{"multiline text", "+CUSD: 1,\"1 Balance\n2 Voucher\",15", "GSM", USSDActionNeeded, "1 Balance\n2 Voucher", 15},
+		{"ucs2 dcs", `+CUSD: 0,"04170434044004300432043E",72`, "GSM", USSDNoActionNeeded, "Здраво", 72},
+		{"ucs2 dcs 0x11", `+CUSD: 0,"0041004200430044",17`, "GSM", USSDNoActionNeeded, "ABCD", 17},
+		{"ucs2 charset", `+CUSD: 0,"0031003200330034",15`, "UCS2", USSDNoActionNeeded, "1234", 15},
+		{"ucs2 odd length", `+CUSD: 0,"004100",72`, "GSM", USSDNoActionNeeded, "004100", 72},
+		{"8bit", `+CUSD: 0,"48694321",68`, "GSM", USSDNoActionNeeded, "HiC!", 68},
+		{"8bit not hex", `+CUSD: 0,"Hello",68`, "GSM", USSDNoActionNeeded, "Hello", 68},
+		{"packed", `+CUSD: 0,"C2303BEC1E974131990B0603",15`, "HEX", USSDNoActionNeeded, "Balance 12.00", 15},
+		{"packed cr padding", `+CUSD: 1,"31D98C56B3DD1A",15`, "HEX", USSDActionNeeded, "1234567", 15},
+		{"packed lower case charset", `+CUSD: 0,"AA180C3602",15`, "hex", USSDNoActionNeeded, "*100#", 15},
+		{"packed not hex", `+CUSD: 0,"Balance",15`, "HEX", USSDNoActionNeeded, "Balance", 15},
+		{"prefix", "AT+CUSD=1,\"*100#\",15\r\nOK\r\n+CUSD: 0,\"x\",15", "GSM", USSDNoActionNeeded, "x", 15},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := ParseCUSDCharset(tt.line, tt.charset)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.Status != tt.status || resp.Text != tt.text || resp.DCS != tt.dcs {
+				t.Errorf("got %v, %q, %d, want %v, %q, %d", resp.Status, resp.Text, resp.DCS, tt.status, tt.text, tt.dcs)
+			}
+		})
+	}
+}
+
+func TestParseCUSDMalformed(t *testing.T) {
+	for _, line := range []string{
+		``,
+		`+CMTI: "SM",1`,
+		`+CUSD: `,
+		`+CUSD: x,"text",15`,
+		`+CUSD: 0,text,15`,
+		`+CUSD: 0,"cut off`,
+	} {
+		if resp, err := ParseCUSD(line); !errors.Is(err, ErrInvalidData) {
+			t.Errorf("ParseCUSD(%q) = %+v, %v, want invalid data", line, resp, err)
+		}
+	}
+}
+
+func TestPackUSSD(t *testing.T) {
+	tests := []struct {
+		input, packed string
+	}{
+		{"*100#", "AA180C3602"},
+		{"1234567", "31D98C56B3DD1A"}, // spare bits filled with carriage return
+		{"12345678", "31D98C56B3DD70"},
+		{"", ""},
+	}
+
+	for _, tt := range tests {
+		packed, err := packUSSD(tt.input)
+		if err != nil || packed != tt.packed {
+			t.Errorf("packUSSD(%q) = %s, %v, want %s", tt.input, packed, err, tt.packed)
+		}
+		if got := decodeUSSD(packed, 15, "HEX"); packed != "" && got != tt.input {
+			t.Errorf("decodeUSSD(%s) = %q, want %q", packed, got, tt.input)
+		}
+	}
+
+	if _, err := packUSSD("ж"); !errors.Is(err, ErrInvalidData) {
+		t.Errorf("packUSSD of unencodable input err = %v", err)
+	}
+}